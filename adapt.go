@@ -0,0 +1,71 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// AdaptHTTPMiddleware turns standard net/http middleware into a Middleware.
+// The context and params are carried across the net/http boundary on the
+// request's context, so values the middleware adds to it are visible to the
+// next handler. The request's own context is merged in rather than
+// replaced, so its values and cancellation carry across too.
+func AdaptHTTPMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(next ContextHandlerFunc) ContextHandlerFunc {
+		inner := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			params, _ := contextParamsKey.Get(ctx)
+			next(ctx, w, req, params)
+		})
+		wrapped := mw(inner)
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			ctx, cancel := mergeContexts(ctx, req.Context())
+			defer cancel()
+			ctx = contextParamsKey.Set(ctx, params)
+			wrapped.ServeHTTP(w, req.WithContext(ctx))
+		}
+	}
+}
+
+// ToHTTPHandler adapts fn to an http.Handler, e.g. for mounting in an
+// http.ServeMux. fn gets ctx merged with the request's context, so it sees
+// the values of both and is cancelled when the request is. Params are taken
+// from the request's context if it carries any.
+func ToHTTPHandler(ctx context.Context, fn ContextHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		params, _ := contextParamsKey.Get(req.Context())
+		merged, cancel := mergeContexts(ctx, req.Context())
+		defer cancel()
+		fn(merged, w, req, params)
+	})
+}
+
+// mergeContexts returns a context with the values of primary and then
+// secondary, that is done when either of them is. It has primary's deadline;
+// secondary's deadline still cancels it when it passes. cancel releases the
+// resources watching secondary.
+func mergeContexts(primary, secondary context.Context) (context.Context, context.CancelFunc) {
+	if primary == secondary {
+		return context.WithCancel(primary)
+	}
+	ctx, cancel := context.WithCancel(primary)
+	stop := context.AfterFunc(secondary, cancel)
+	return mergedContext{ctx, secondary}, func() {
+		stop()
+		cancel()
+	}
+}
+
+type mergedContext struct {
+	context.Context
+	secondary context.Context
+}
+
+func (c mergedContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.secondary.Value(key)
+}
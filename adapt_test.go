@@ -0,0 +1,49 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type adaptTestKey string
+
+func TestAdaptHTTPMiddlewareKeepsRequestContext(t *testing.T) {
+	passThrough := func(next http.Handler) http.Handler { return next }
+	var got context.Context
+	var gotParams httprouter.Params
+	var cancelled bool
+	handler := AdaptHTTPMiddleware(passThrough)(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		got = ctx
+		gotParams = params
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-time.After(time.Second):
+		}
+	})
+
+	reqCtx, cancel := context.WithCancel(context.WithValue(context.Background(), adaptTestKey("req"), "from request"))
+	req := httptest.NewRequest("GET", "/", nil).WithContext(reqCtx)
+	ctx := context.WithValue(context.Background(), adaptTestKey("handler"), "from handler")
+	params := httprouter.Params{{Key: "id", Value: "1"}}
+	cancel()
+	handler(ctx, httptest.NewRecorder(), req, params)
+
+	if v := got.Value(adaptTestKey("handler")); v != "from handler" {
+		t.Errorf("handler context value = %v", v)
+	}
+	if v := got.Value(adaptTestKey("req")); v != "from request" {
+		t.Errorf("request context value = %v", v)
+	}
+	if !cancelled {
+		t.Error("request cancellation did not propagate")
+	}
+	if gotParams.ByName("id") != "1" {
+		t.Errorf("params = %v", gotParams)
+	}
+}
@@ -0,0 +1,34 @@
+// Package appkittest provides helpers for testing handlers built with appkit.
+package appkittest
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/t11e/go-appkit"
+)
+
+// NewTestLoggerContext returns a context whose logger writes to the returned
+// buffer, so tests can assert on what a handler logged. Each line is also
+// passed to tb.Log, so it shows up when the test fails or runs with -v.
+func NewTestLoggerContext(tb testing.TB) (context.Context, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	logger := log.New(&tbWriter{tb: tb, buf: buf}, "", 0)
+	return appkit.ContextWithLogger(context.Background(), logger), buf
+}
+
+// tbWriter copies writes to buf and tb.Log. The logger it is used by
+// serializes writes.
+type tbWriter struct {
+	tb  testing.TB
+	buf *bytes.Buffer
+}
+
+func (w *tbWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	w.tb.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,142 @@
+package appkit
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what an AsyncWriter does when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// BlockWhenFull makes Write wait for space in the buffer.
+	BlockWhenFull OverflowPolicy = iota
+	// DropWhenFull makes Write discard the line, counting it in Dropped.
+	DropWhenFull
+)
+
+// ErrAsyncWriterClosed is returned by writes to a closed AsyncWriter.
+var ErrAsyncWriterClosed = errors.New("appkit: async writer closed")
+
+// AsyncWriter is an io.Writer that hands writes to a background goroutine,
+// so that a slow destination does not hold up requests. Use it as the
+// logging middleware's output with WithOutput.
+//
+// Writes reach the destination in the order Write was called; writes from a
+// single goroutine, such as a request's start and end lines, therefore stay
+// in order, while writes from concurrent requests interleave line by line.
+// Errors from the destination are reported by Flush and Close.
+type AsyncWriter struct {
+	out     io.Writer
+	policy  OverflowPolicy
+	queue   chan asyncWrite
+	done    chan struct{}
+	dropped uint64
+
+	mu     sync.RWMutex
+	closed bool
+
+	errMu sync.Mutex
+	err   error
+}
+
+type asyncWrite struct {
+	data []byte
+	// flushed, if set, is closed once everything queued before it has been
+	// written.
+	flushed chan struct{}
+}
+
+// NewAsyncWriter returns an AsyncWriter that buffers up to bufferSize writes
+// for out.
+func NewAsyncWriter(out io.Writer, bufferSize int, policy OverflowPolicy) *AsyncWriter {
+	w := &AsyncWriter{
+		out:    out,
+		policy: policy,
+		queue:  make(chan asyncWrite, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go w.drain()
+	return w
+}
+
+func (w *AsyncWriter) drain() {
+	defer close(w.done)
+	for msg := range w.queue {
+		if msg.flushed != nil {
+			close(msg.flushed)
+			continue
+		}
+		if _, err := w.out.Write(msg.data); err != nil {
+			w.setErr(err)
+		}
+	}
+}
+
+// Write queues a copy of p. It never reports errors from the destination.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrAsyncWriterClosed
+	}
+	msg := asyncWrite{data: append([]byte(nil), p...)}
+	if w.policy == DropWhenFull {
+		select {
+		case w.queue <- msg:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+	} else {
+		w.queue <- msg
+	}
+	return len(p), nil
+}
+
+// Flush blocks until everything written so far has reached the destination.
+func (w *AsyncWriter) Flush() error {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return w.getErr()
+	}
+	flushed := make(chan struct{})
+	w.queue <- asyncWrite{flushed: flushed}
+	w.mu.RUnlock()
+	<-flushed
+	return w.getErr()
+}
+
+// Close drains the buffer and stops the background goroutine. Writes after
+// Close fail with ErrAsyncWriterClosed.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.getErr()
+}
+
+// Dropped returns how many writes were discarded under DropWhenFull.
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (w *AsyncWriter) setErr(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *AsyncWriter) getErr() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
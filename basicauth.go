@@ -0,0 +1,39 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var contextUserKey = NewContextKey[string]("user")
+
+// WrapBasicAuth requires requests to carry HTTP basic credentials accepted by
+// verify. Other requests get a 401 with a WWW-Authenticate challenge for
+// realm. The authenticated username is available from UserFromContext.
+//
+// The logging middleware redacts the Authorization header by default.
+func WrapBasicAuth(verify func(user, pass string) bool, realm string, handler ContextHandlerFunc) ContextHandlerFunc {
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		user, pass, ok := req.BasicAuth()
+		if !ok || !verify(user, pass) {
+			if ok {
+				GetLoggerFromContext(ctx).Printf("Basic auth failed for user %q", user)
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler(contextUserKey.Set(ctx, user), w, req, params)
+	}
+}
+
+// UserFromContext returns the username authenticated by WrapBasicAuth, or an
+// empty string if there is none.
+func UserFromContext(ctx context.Context) string {
+	user, _ := contextUserKey.Get(ctx)
+	return user
+}
@@ -0,0 +1,160 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const defaultBufferMaxSize = 1 << 20
+
+// BufferOptions configures the buffering middleware.
+type BufferOptions struct {
+	// MaxSize is the largest response body, in bytes, held in memory. A
+	// response that grows past it is sent as it is written from then on,
+	// and can no longer be rolled back. Defaults to 1MB.
+	MaxSize int
+}
+
+// WrapBufferHandler holds the response in memory until handler returns, so
+// that it can be discarded with RollbackResponse if handler fails part way
+// through. WrapErrorHandler and WrapRecoveryHandler roll back for themselves,
+// giving a clean error response instead of a truncated one. Place it inside
+// WrapLoggingHandler, e.g. Chain(WrapLoggingHandler, WrapBufferHandler).
+//
+// Flushing, or sending the body with ReadFrom, commits the response.
+func WrapBufferHandler(handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapBufferHandlerWithOptions(handler, BufferOptions{})
+}
+
+func WrapBufferHandlerWithOptions(handler ContextHandlerFunc, opts BufferOptions) ContextHandlerFunc {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultBufferMaxSize
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		bufferW := &bufferWriter{
+			loggingResponseWriter: loggingW,
+			maxSize:               opts.MaxSize,
+			initialHeader:         loggingW.Header().Clone(),
+		}
+		handler(ctx, bufferW, req, params)
+		bufferW.commit()
+	}
+}
+
+// RollbackResponse discards the status, headers and body written to w so
+// far, so that a different response can be written instead. It reports
+// false, changing nothing, if w is not buffered by WrapBufferHandler or the
+// response has already been sent.
+func RollbackResponse(w http.ResponseWriter) bool {
+	r, ok := w.(interface{ rollback() bool })
+	return ok && r.rollback()
+}
+
+// bufferWriter holds the response until commit, or until it is flushed or
+// outgrows maxSize, after which it passes writes through.
+type bufferWriter struct {
+	loggingResponseWriter
+	maxSize int
+	// initialHeader is restored on rollback, discarding headers set by the
+	// handler but keeping those set before it ran, such as the request ID.
+	initialHeader http.Header
+	status        int
+	buf           bytes.Buffer
+	streaming     bool
+}
+
+func (b *bufferWriter) WriteHeader(status int) {
+	if b.streaming {
+		b.loggingResponseWriter.WriteHeader(status)
+		return
+	}
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	if b.streaming {
+		return b.loggingResponseWriter.Write(p)
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	if b.buf.Len()+len(p) > b.maxSize {
+		if err := b.commit(); err != nil {
+			return 0, err
+		}
+		return b.loggingResponseWriter.Write(p)
+	}
+	return b.buf.Write(p)
+}
+
+func (b *bufferWriter) ReadFrom(r io.Reader) (int64, error) {
+	if err := b.commit(); err != nil {
+		return 0, err
+	}
+	return b.loggingResponseWriter.ReadFrom(r)
+}
+
+func (b *bufferWriter) Flush() {
+	b.commit()
+	b.loggingResponseWriter.Flush()
+}
+
+func (b *bufferWriter) Status() int {
+	if b.streaming {
+		return b.loggingResponseWriter.Status()
+	}
+	return b.status
+}
+
+func (b *bufferWriter) Size() int64 {
+	return b.loggingResponseWriter.Size() + int64(b.buf.Len())
+}
+
+func (b *bufferWriter) WroteHeader() bool {
+	if b.streaming {
+		return b.loggingResponseWriter.WroteHeader()
+	}
+	return b.status != 0
+}
+
+func (b *bufferWriter) rollback() bool {
+	if b.streaming {
+		return false
+	}
+	b.status = 0
+	b.buf.Reset()
+	header := b.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range b.initialHeader {
+		header[name] = values
+	}
+	return true
+}
+
+// commit sends what has been buffered and switches to passing writes
+// through.
+func (b *bufferWriter) commit() error {
+	if b.streaming {
+		return nil
+	}
+	b.streaming = true
+	if b.status == 0 {
+		return nil
+	}
+	b.loggingResponseWriter.WriteHeader(b.status)
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	_, err := b.loggingResponseWriter.Write(b.buf.Bytes())
+	b.buf = bytes.Buffer{}
+	return err
+}
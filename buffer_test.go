@@ -0,0 +1,91 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRollbackResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		write        func(w http.ResponseWriter)
+		wantRollback bool
+		wantBody     string
+	}{
+		{
+			name: "buffered",
+			write: func(w http.ResponseWriter) {
+				w.Header().Set("X-Partial", "yes")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("partial"))
+			},
+			wantRollback: true,
+			wantBody:     "replacement",
+		},
+		{
+			name: "past MaxSize",
+			write: func(w http.ResponseWriter) {
+				w.Write([]byte(strings.Repeat("x", 32)))
+			},
+			wantBody: strings.Repeat("x", 32),
+		},
+		{
+			name: "flushed",
+			write: func(w http.ResponseWriter) {
+				w.Write([]byte("sent"))
+				w.(http.Flusher).Flush()
+			},
+			wantBody: "sent",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var rolledBack bool
+			handler := WrapBufferHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+				tc.write(w)
+				if rolledBack = RollbackResponse(w); rolledBack {
+					w.Write([]byte("replacement"))
+				}
+			}, BufferOptions{MaxSize: 16})
+			rec := httptest.NewRecorder()
+			rec.Header().Set("X-Request-ID", "req-1")
+			handler(context.Background(), rec, httptest.NewRequest("GET", "/", nil), nil)
+
+			if rolledBack != tc.wantRollback {
+				t.Errorf("RollbackResponse() = %t, want %t", rolledBack, tc.wantRollback)
+			}
+			if rec.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+			if rec.Header().Get("X-Request-ID") != "req-1" {
+				t.Error("header set before the handler ran was lost")
+			}
+			if tc.wantRollback && (rec.Code != http.StatusOK || rec.Header().Get("X-Partial") != "") {
+				t.Errorf("rolled back response kept status %d and X-Partial %q", rec.Code, rec.Header().Get("X-Partial"))
+			}
+		})
+	}
+}
+
+func TestRollbackResponseUnbuffered(t *testing.T) {
+	if RollbackResponse(httptest.NewRecorder()) {
+		t.Error("RollbackResponse() succeeded on an unbuffered writer")
+	}
+}
+
+func TestWrapErrorHandlerRollsBackBufferedResponse(t *testing.T) {
+	handler := WrapBufferHandler(WrapErrorHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) error {
+		w.Write([]byte("half a page"))
+		return ErrNotFound
+	}, nil))
+	rec := httptest.NewRecorder()
+	handler(context.Background(), rec, httptest.NewRequest("GET", "/", nil), nil)
+	if rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "half a page") {
+		t.Errorf("got %d %q, want a clean 404", rec.Code, rec.Body.String())
+	}
+}
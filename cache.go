@@ -0,0 +1,110 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// WrapCache serves GET requests from store when it holds a response under
+// keyFn's key, and otherwise runs handler and stores its response for ttl
+// if it is a 200 that may be cached: not marked no-store or private, not
+// setting cookies, not varying on everything (Vary: *), and no larger than
+// 1MB. keyFn defaults to the request URI. A response with a Vary header is
+// only replayed to requests whose named headers match those of the request
+// it was stored for. Responses carry X-Cache: HIT or MISS. Requests with
+// Cache-Control: no-store bypass the cache.
+//
+// Place it inside WrapLoggingHandler so cache hits are logged with the
+// bytes actually sent.
+func WrapCache(store ResponseStore, keyFn func(req *http.Request) string, ttl time.Duration, handler ContextHandlerFunc) ContextHandlerFunc {
+	if keyFn == nil {
+		keyFn = func(req *http.Request) string { return req.URL.RequestURI() }
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if req.Method != http.MethodGet || hasCacheDirective(req.Header, "no-store") {
+			handler(ctx, w, req, params)
+			return
+		}
+		key := keyFn(req)
+		resp, ok := store.Get(key)
+		if ok && resp.Status == 0 {
+			// A marker left by a response with Vary; the variants are
+			// stored under keys that include the varying headers.
+			resp, ok = store.Get(varyKey(key, resp.Header.Values("Vary"), req))
+		}
+		if ok {
+			w.Header().Set("X-Cache", "HIT")
+			writeStoredResponse(w, resp)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		captureW := &captureWriter{loggingResponseWriter: loggingW, maxSize: defaultStoreMaxSize}
+		handler(ctx, captureW, req, params)
+		resp, ok = captureW.response()
+		if !ok || resp.Status != http.StatusOK || resp.Header.Get("Set-Cookie") != "" ||
+			hasCacheDirective(resp.Header, "no-store") || hasCacheDirective(resp.Header, "private") {
+			return
+		}
+		if vary := varyNames(resp.Header); len(vary) > 0 {
+			if vary[0] == "*" {
+				return
+			}
+			store.Set(key, &StoredResponse{Header: http.Header{"Vary": vary}}, ttl)
+			key = varyKey(key, vary, req)
+		}
+		store.Set(key, resp, ttl)
+	}
+}
+
+// varyNames returns the canonical header names listed in h's Vary header,
+// or just "*" if it varies on everything.
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			switch name {
+			case "":
+				continue
+			case "*":
+				return []string{"*"}
+			}
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names
+}
+
+// varyKey returns the key of the variant of key selected by the values of
+// the vary headers in req.
+func varyKey(key string, vary []string, req *http.Request) string {
+	var buf strings.Builder
+	buf.WriteString(key)
+	for _, name := range vary {
+		buf.WriteString("\x00")
+		buf.WriteString(name)
+		buf.WriteString("=")
+		buf.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return buf.String()
+}
+
+// hasCacheDirective reports whether the Cache-Control header in h contains
+// directive.
+func hasCacheDirective(h http.Header, directive string) bool {
+	for _, value := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(name, directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
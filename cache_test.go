@@ -0,0 +1,47 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapCacheVary(t *testing.T) {
+	body := bytes.Repeat([]byte("cacheable "), 500)
+	handler := WrapCache(NewMemoryStore(), nil, time.Minute, WrapGzipHandler(
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(body)
+		}))
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/page", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler(context.Background(), rec, req, nil)
+		return rec
+	}
+
+	if rec := get("gzip"); rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first gzip request: encoding %q, cache %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("X-Cache"))
+	}
+	if rec := get("gzip"); rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("second gzip request: encoding %q, cache %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("X-Cache"))
+	}
+	rec := get("")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("identity request: encoding %q, cache %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("X-Cache"))
+	}
+	if !bytes.Equal(rec.Body.Bytes(), body) {
+		t.Errorf("identity request got %d bytes, want the plain body", rec.Body.Len())
+	}
+	if rec := get(""); rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("second identity request: encoding %q, cache %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("X-Cache"))
+	}
+}
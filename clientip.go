@@ -0,0 +1,103 @@
+package appkit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultTrustedProxies are the loopback and private ranges, where reverse
+// proxies usually run. They are the default trusted proxies wherever proxy
+// headers are trusted.
+var DefaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// trustedProxyNets parses proxies, or DefaultTrustedProxies if it is nil,
+// for clientIP. It returns nil if trustProxy is not set, so that proxy
+// headers are ignored.
+func trustedProxyNets(trustProxy bool, proxies []string) []*net.IPNet {
+	if !trustProxy {
+		return nil
+	}
+	if proxies == nil {
+		proxies = DefaultTrustedProxies
+	}
+	return mustParseIPNets(proxies)
+}
+
+// clientIP returns the IP address of the client that made req. If the
+// connection comes from one of the trusted proxies, X-Forwarded-For is
+// walked from the right, skipping the hops added by trusted proxies, and
+// the first other address is used, as the left-most hops can be set by the
+// client to anything. If there is no X-Forwarded-For, X-Real-IP is used.
+// Otherwise the address is taken from req.RemoteAddr.
+func clientIP(req *http.Request, trusted []*net.IPNet) string {
+	ip := parseHostIP(req.RemoteAddr)
+	if ip == nil {
+		return req.RemoteAddr
+	}
+	if !ipNetsContain(trusted, ip) {
+		return ip.String()
+	}
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	if len(hops) == 1 && strings.TrimSpace(hops[0]) == "" {
+		if realIP := parseHostIP(req.Header.Get("X-Real-IP")); realIP != nil {
+			return realIP.String()
+		}
+		return ip.String()
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHostIP(hops[i])
+		if hop == nil {
+			// The chain is broken, so nothing further left can be trusted.
+			break
+		}
+		ip = hop
+		if !ipNetsContain(trusted, ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// parseHostIP parses an address of the form "ip", "ip:port", "[ipv6]" or
+// "[ipv6]:port", returning nil if it does not contain a valid IP.
+func parseHostIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	return net.ParseIP(addr)
+}
+
+// RequestScheme returns "https" or "http" according to how the client
+// connected, e.g. for building absolute URLs. Behind a TLS-terminating proxy
+// the connection itself is plain HTTP, so if trustProxy is set the scheme is
+// taken from X-Forwarded-Proto when present. Only set it when running behind
+// a trusted proxy.
+func RequestScheme(req *http.Request, trustProxy bool) string {
+	if trustProxy {
+		proto := req.Header.Get("X-Forwarded-Proto")
+		if i := strings.IndexByte(proto, ','); i >= 0 {
+			proto = proto[:i]
+		}
+		switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+		case "http", "https":
+			return proto
+		}
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
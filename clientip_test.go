@@ -0,0 +1,43 @@
+package appkit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		trustProxy bool
+		want       string
+	}{
+		{name: "remote addr", remoteAddr: "203.0.113.9:1234", want: "203.0.113.9"},
+		{name: "headers ignored without trust", remoteAddr: "10.0.0.2:1234", xff: []string{"198.51.100.1"}, want: "10.0.0.2"},
+		{name: "untrusted remote", remoteAddr: "203.0.113.9:1234", xff: []string{"10.0.0.1, 203.0.113.9"}, trustProxy: true, want: "203.0.113.9"},
+		{name: "spoofed left-most hop", remoteAddr: "10.0.0.2:1234", xff: []string{"10.0.0.1, 203.0.113.9"}, trustProxy: true, want: "203.0.113.9"},
+		{name: "chain of trusted proxies", remoteAddr: "10.0.0.2:1234", xff: []string{"198.51.100.1, 203.0.113.9, 10.0.0.3"}, trustProxy: true, want: "203.0.113.9"},
+		{name: "repeated header", remoteAddr: "10.0.0.2:1234", xff: []string{"198.51.100.1", "203.0.113.9"}, trustProxy: true, want: "203.0.113.9"},
+		{name: "all hops trusted", remoteAddr: "10.0.0.2:1234", xff: []string{"10.0.0.5, 10.0.0.3"}, trustProxy: true, want: "10.0.0.5"},
+		{name: "invalid hop", remoteAddr: "10.0.0.2:1234", xff: []string{"203.0.113.9, garbage, 10.0.0.3"}, trustProxy: true, want: "10.0.0.3"},
+		{name: "real ip", remoteAddr: "127.0.0.1:1234", realIP: "203.0.113.9", trustProxy: true, want: "203.0.113.9"},
+		{name: "ipv6 remote", remoteAddr: "[2001:db8::1]:1234", want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := clientIP(req, trustedProxyNets(tt.trustProxy, nil)); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package appkit
+
+import "time"
+
+// clock abstracts the current time so that tests can control it.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
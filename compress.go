@@ -0,0 +1,363 @@
+package appkit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/julienschmidt/httprouter"
+)
+
+const defaultGzipMinSize = 1024
+
+// Content codings supported by the compression middleware.
+const (
+	EncodingBrotli  = "br"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressEncodings are the content codings offered by
+// WrapCompressHandler, most preferred first.
+var DefaultCompressEncodings = []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+
+// DefaultGzipSkipContentTypes are content type prefixes that are already
+// compressed and so are not gzipped again.
+var DefaultGzipSkipContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+}
+
+// compressor is the interface shared by the gzip, zlib and brotli writers.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressorPools reuse compressors, which are expensive to allocate.
+var compressorPools = map[string]*sync.Pool{
+	EncodingBrotli:  {New: func() interface{} { return brotli.NewWriter(nil) }},
+	EncodingGzip:    {New: func() interface{} { return gzip.NewWriter(nil) }},
+	EncodingDeflate: {New: func() interface{} { return zlib.NewWriter(nil) }},
+}
+
+// GzipOptions configures the gzip middleware.
+type GzipOptions struct {
+	// MinSize is the smallest response, in bytes, that is compressed.
+	// Defaults to 1024.
+	MinSize int
+	// SkipContentTypes are content type prefixes that are never compressed.
+	// Defaults to DefaultGzipSkipContentTypes.
+	SkipContentTypes []string
+}
+
+// CompressOptions configures the compression middleware.
+type CompressOptions struct {
+	// MinSize is the smallest response, in bytes, that is compressed.
+	// Defaults to 1024.
+	MinSize int
+	// SkipContentTypes are content type prefixes that are never compressed.
+	// Defaults to DefaultGzipSkipContentTypes.
+	SkipContentTypes []string
+	// Encodings are the content codings offered, most preferred first. The
+	// client's quality values decide between them, and this order breaks
+	// ties. Defaults to DefaultCompressEncodings.
+	Encodings []string
+}
+
+// WrapGzipHandler gzips responses for clients that accept it. Place it
+// inside WrapLoggingHandler, e.g. Chain(WrapLoggingHandler, WrapGzipHandler),
+// so that the logged size is the number of compressed bytes sent.
+func WrapGzipHandler(handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapGzipHandlerWithOptions(handler, GzipOptions{})
+}
+
+func WrapGzipHandlerWithOptions(handler ContextHandlerFunc, opts GzipOptions) ContextHandlerFunc {
+	return WrapCompressHandlerWithOptions(handler, CompressOptions{
+		MinSize:          opts.MinSize,
+		SkipContentTypes: opts.SkipContentTypes,
+		Encodings:        []string{EncodingGzip},
+	})
+}
+
+// WrapCompressHandler is like WrapGzipHandler, but also offers brotli and
+// deflate, using whichever the client's Accept-Encoding prefers. Responses
+// are sent uncompressed if the client accepts none of them.
+func WrapCompressHandler(handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapCompressHandlerWithOptions(handler, CompressOptions{})
+}
+
+// WrapCompressHandlerWithOptions panics if opts.Encodings names an
+// unsupported coding.
+func WrapCompressHandlerWithOptions(handler ContextHandlerFunc, opts CompressOptions) ContextHandlerFunc {
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultGzipMinSize
+	}
+	if opts.SkipContentTypes == nil {
+		opts.SkipContentTypes = DefaultGzipSkipContentTypes
+	}
+	if opts.Encodings == nil {
+		opts.Encodings = DefaultCompressEncodings
+	}
+	for _, encoding := range opts.Encodings {
+		if compressorPools[encoding] == nil {
+			panic("appkit: unsupported content coding " + strconv.Quote(encoding))
+		}
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"), opts.Encodings)
+		if req.Method == "HEAD" || encoding == "" {
+			handler(ctx, w, req, params)
+			return
+		}
+
+		compressW := &compressResponseWriter{w: w, opts: &opts, encoding: encoding}
+		handler(ctx, wrapCompressResponseWriter(compressW), req, params)
+		compressW.close()
+	}
+}
+
+// negotiateEncoding returns the coding in encodings that an Accept-Encoding
+// header value gives the highest quality, preferring earlier ones on ties,
+// or an empty string if it accepts none of them.
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressResponseWriter buffers the start of the response until it knows
+// whether to compress it, which requires the content type and at least
+// MinSize bytes of body.
+type compressResponseWriter struct {
+	w        http.ResponseWriter
+	opts     *CompressOptions
+	encoding string
+	status   int
+	buf      bytes.Buffer
+	// decided is set once the headers have been sent, after which enc is
+	// non-nil if and only if the response is being compressed.
+	decided bool
+	enc     compressor
+	// hijacked is set once the handler has taken over the connection, after
+	// which nothing more is written to w.
+	hijacked bool
+}
+
+// wrapCompressResponseWriter returns c with the Hijacker and Pusher of the
+// writer it wraps.
+func wrapCompressResponseWriter(c *compressResponseWriter) http.ResponseWriter {
+	_, ok1 := c.w.(http.Hijacker)
+	p, ok2 := c.w.(http.Pusher)
+	switch {
+	case ok1 && ok2:
+		return struct {
+			compressHijacker
+			http.Pusher
+		}{compressHijacker{c}, p}
+	case ok1:
+		return compressHijacker{c}
+	case ok2:
+		return struct {
+			*compressResponseWriter
+			http.Pusher
+		}{c, p}
+	}
+	return c
+}
+
+type compressHijacker struct {
+	*compressResponseWriter
+}
+
+// Hijack hands the connection over, dropping whatever is buffered or being
+// compressed.
+func (c compressHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := c.w.(http.Hijacker).Hijack()
+	if err == nil {
+		c.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (c *compressResponseWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *compressResponseWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		return
+	}
+	c.status = status
+}
+
+func (c *compressResponseWriter) Write(b []byte) (int, error) {
+	if c.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if c.decided {
+		if c.enc != nil {
+			return c.enc.Write(b)
+		}
+		return c.w.Write(b)
+	}
+	c.buf.Write(b)
+	if c.buf.Len() >= c.opts.MinSize {
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *compressResponseWriter) Flush() {
+	if c.hijacked {
+		return
+	}
+	if !c.decided {
+		if c.buf.Len() == 0 {
+			// There is nothing to sniff the content type from yet, so leave
+			// the decision to the first Write.
+			return
+		}
+		c.decide(true)
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide sends the headers, compressing if large is set and the response
+// is eligible, and then writes out whatever has been buffered.
+func (c *compressResponseWriter) decide(large bool) error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	h := c.w.Header()
+	if large && c.shouldCompress(h) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", c.encoding)
+		c.enc = compressorPools[c.encoding].Get().(compressor)
+		c.enc.Reset(c.w)
+	}
+	c.w.WriteHeader(c.status)
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(c.buf.Bytes())
+	} else {
+		_, err = c.w.Write(c.buf.Bytes())
+	}
+	c.buf.Reset()
+	return err
+}
+
+func (c *compressResponseWriter) shouldCompress(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	switch c.status {
+	case http.StatusNoContent, http.StatusNotModified:
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" && c.buf.Len() > 0 {
+		contentType = http.DetectContentType(c.buf.Bytes())
+		h.Set("Content-Type", contentType)
+	}
+	for _, prefix := range c.opts.SkipContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (c *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+func (c *compressResponseWriter) close() {
+	if c.hijacked {
+		c.releaseEncoder()
+		return
+	}
+	if !c.decided {
+		if c.status == 0 && c.buf.Len() == 0 {
+			// The handler wrote nothing; leave the response to net/http.
+			return
+		}
+		c.decide(false)
+	}
+	if c.enc != nil {
+		c.enc.Close()
+	}
+	c.releaseEncoder()
+}
+
+// releaseEncoder returns the encoder, if any, to its pool.
+func (c *compressResponseWriter) releaseEncoder() {
+	if c.enc == nil {
+		return
+	}
+	c.enc.Reset(nil)
+	compressorPools[c.encoding].Put(c.enc)
+	c.enc = nil
+}
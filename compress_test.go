@@ -0,0 +1,89 @@
+package appkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestCompressFlushBeforeWriteKeepsContentType(t *testing.T) {
+	handler := WrapCompressHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		w.(http.Flusher).Flush()
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(strings.Repeat(`{"n":1}`+"\n", 200)))
+	})
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(context.Background(), rec, req, nil)
+
+	// Result has the headers as they were when the response was committed.
+	header := rec.Result().Header
+	if got := header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+	}
+	if got := header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+}
+
+func TestCompressWriterKeepsOptionalInterfaces(t *testing.T) {
+	rec := hijackRecorder{httptest.NewRecorder()}
+	var (
+		unwrapped http.ResponseWriter
+		hijackErr error
+		writeErr  error
+	)
+	handler := WrapCompressHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+			unwrapped = u.Unwrap()
+		}
+		w.Write([]byte("discarded"))
+		var conn net.Conn
+		conn, _, hijackErr = http.NewResponseController(w).Hijack()
+		if hijackErr == nil {
+			conn.Close()
+		}
+		_, writeErr = w.Write([]byte("too late"))
+	})
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler(context.Background(), rec, req, nil)
+
+	if unwrapped != rec {
+		t.Errorf("Unwrap() = %v, want the underlying writer", unwrapped)
+	}
+	if hijackErr != nil {
+		t.Fatalf("Hijack() failed: %s", hijackErr)
+	}
+	if writeErr != http.ErrHijacked {
+		t.Errorf("Write after Hijack returned %v, want http.ErrHijacked", writeErr)
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("hijacked response was written: %q, headers %v", rec.Body.String(), rec.Header())
+	}
+}
+
+func TestCompressWriterKeepsPusher(t *testing.T) {
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	var isPusher, isHijacker bool
+	handler := WrapCompressHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		_, isPusher = w.(http.Pusher)
+		_, isHijacker = w.(http.Hijacker)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler(context.Background(), rec, req, nil)
+
+	if !isPusher {
+		t.Error("compressing writer does not implement http.Pusher")
+	}
+	if isHijacker {
+		t.Error("compressing writer implements http.Hijacker although the underlying writer does not")
+	}
+}
@@ -0,0 +1,53 @@
+package appkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ConcurrencyLimitOptions configures the concurrency-limiting middleware.
+type ConcurrencyLimitOptions struct {
+	// Reject makes requests that arrive while the limit is reached get a 503
+	// immediately, instead of waiting for a slot.
+	Reject bool
+}
+
+// WrapConcurrencyLimit lets at most max requests run handler at once. Further
+// requests wait for a slot, and get a 503 if their context ends first. It
+// panics if max is not positive.
+func WrapConcurrencyLimit(max int, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapConcurrencyLimitWithOptions(max, handler, ConcurrencyLimitOptions{})
+}
+
+func WrapConcurrencyLimitWithOptions(max int, handler ContextHandlerFunc, opts ConcurrencyLimitOptions) ContextHandlerFunc {
+	if max <= 0 {
+		panic(fmt.Sprintf("appkit: concurrency limit must be positive, got %d", max))
+	}
+	slots := make(chan struct{}, max)
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			if opts.Reject {
+				shedOverLimit(ctx, w, max, "limit reached")
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				shedOverLimit(ctx, w, max, ctx.Err().Error())
+				return
+			}
+		}
+		defer func() { <-slots }()
+		handler(ctx, w, req, params)
+	}
+}
+
+func shedOverLimit(ctx context.Context, w http.ResponseWriter, max int, reason string) {
+	GetLoggerFromContext(ctx).Printf("Concurrency limit of %d reached, shedding request: %s", max, reason)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
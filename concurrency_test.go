@@ -0,0 +1,40 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestConcurrencyLimitRejectsNonPositiveMax(t *testing.T) {
+	for _, max := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WrapConcurrencyLimit(%d, ...) did not panic", max)
+				}
+			}()
+			WrapConcurrencyLimit(max, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			})
+		}()
+	}
+}
+
+func TestConcurrencyLimitRejectsOverLimit(t *testing.T) {
+	var inner *httptest.ResponseRecorder
+	var handler ContextHandlerFunc
+	handler = WrapConcurrencyLimitWithOptions(1, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if inner == nil {
+			inner = httptest.NewRecorder()
+			handler(ctx, inner, req, params)
+		}
+	}, ConcurrencyLimitOptions{Reject: true})
+	handler(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+
+	if inner.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit got %d, want %d", inner.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,99 @@
+package appkit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	consoleTimestampLayout = "15:04:05.000"
+
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// useConsoleColor reports whether console lines written to out should be
+// colored: out must be a terminal, and neither disabled nor NO_COLOR set.
+func useConsoleColor(out io.Writer, disabled bool) bool {
+	if disabled || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(buf *bytes.Buffer, color bool, code string, s string) {
+	if color {
+		buf.WriteString(code)
+		buf.WriteString(s)
+		buf.WriteString(ansiReset)
+	} else {
+		buf.WriteString(s)
+	}
+}
+
+func writeConsolePrefix(buf *bytes.Buffer, entry *logEntry, timestamp time.Time) {
+	if entry.timestampLayout != "" {
+		colorize(buf, entry.consoleColor, ansiDim, timestamp.Format(consoleTimestampLayout))
+		buf.WriteString(" ")
+	}
+	colorize(buf, entry.consoleColor, ansiDim, "["+entry.id+"]")
+	buf.WriteString(" ")
+}
+
+func writeConsoleStartLine(
+	logger *log.Logger,
+	entry *logEntry,
+	timestamp time.Time) {
+	buf := new(bytes.Buffer)
+	writeConsolePrefix(buf, entry, timestamp)
+	colorize(buf, entry.consoleColor, ansiDim, fmt.Sprintf("--> %-7s %s", entry.method, entry.url))
+	logger.Print(buf.String())
+}
+
+func writeConsoleEndLine(
+	logger *log.Logger,
+	entry *logEntry,
+	timestamp time.Time,
+	status int,
+	size int64,
+	elapsedTime time.Duration) {
+	buf := new(bytes.Buffer)
+	writeConsolePrefix(buf, entry, timestamp)
+	statusColor := ansiGreen
+	switch {
+	case status >= 500:
+		statusColor = ansiRed
+	case status >= 400:
+		statusColor = ansiYellow
+	case status >= 300:
+		statusColor = ansiCyan
+	}
+	colorize(buf, entry.consoleColor, statusColor, fmt.Sprintf("%3d", status))
+	fmt.Fprintf(buf, " %9s %9s %-7s %s",
+		formatDuration(elapsedTime, entry.durationUnit), fmt.Sprintf("%dB", size), entry.method, entry.url)
+	if entry.route != "" {
+		fmt.Fprintf(buf, " route=%s", entry.route)
+	}
+	if entry.isSlow(elapsedTime) {
+		buf.WriteString(" ")
+		colorize(buf, entry.consoleColor, ansiYellow, "SLOW")
+	}
+	if entry.err != "" {
+		buf.WriteString(" ")
+		colorize(buf, entry.consoleColor, ansiRed, fmt.Sprintf("error=%q", entry.err))
+	}
+	logger.Print(buf.String())
+}
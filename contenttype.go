@@ -0,0 +1,40 @@
+package appkit
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// WrapRequireContentType answers requests that carry a body with a 415
+// unless their Content-Type is one of types, e.g. "application/json".
+// Matching is case-insensitive and ignores parameters such as charset.
+// Requests without a body, including GET and HEAD, are let through.
+func WrapRequireContentType(types []string, handler ContextHandlerFunc) ContextHandlerFunc {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[strings.ToLower(t)] = true
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			handler(ctx, w, req, params)
+			return
+		}
+		if req.ContentLength == 0 || req.Body == nil || req.Body == http.NoBody {
+			handler(ctx, w, req, params)
+			return
+		}
+		header := req.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil || !allowed[mediaType] {
+			GetLoggerFromContext(ctx).Printf("Unsupported content type %q", header)
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+		handler(ctx, w, req, params)
+	}
+}
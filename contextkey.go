@@ -0,0 +1,41 @@
+package appkit
+
+import "context"
+
+// ContextKey is a typed key for a request-scoped value of type T. Each key
+// created with NewContextKey is distinct from every other, so packages can
+// store values without colliding on key names.
+//
+//	var userKey = appkit.NewContextKey[*User]("user")
+//
+//	ctx = userKey.Set(ctx, user)
+//	user, ok := userKey.Get(ctx)
+type ContextKey[T any] struct {
+	key *contextKey
+}
+
+// contextKey is the value actually stored in contexts. Comparing pointers
+// keeps keys with the same name distinct.
+type contextKey struct {
+	name string
+}
+
+// NewContextKey returns a new key. The name is only used for debugging.
+func NewContextKey[T any](name string) ContextKey[T] {
+	return ContextKey[T]{key: &contextKey{name: name}}
+}
+
+// Set returns a copy of ctx carrying v under k.
+func (k ContextKey[T]) Set(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k.key, v)
+}
+
+// Get returns the value stored under k, and whether there was one.
+func (k ContextKey[T]) Get(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k.key).(T)
+	return v, ok
+}
+
+func (k ContextKey[T]) String() string {
+	return "appkit.ContextKey(" + k.key.name + ")"
+}
@@ -1,10 +1,10 @@
 package appkit
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
-	"golang.org/x/net/context"
 )
 
 type ContextHandlerFunc func(
@@ -13,8 +13,56 @@ type ContextHandlerFunc func(
 	req *http.Request,
 	params httprouter.Params)
 
+var (
+	contextRoutePatternKey = NewContextKey[string]("routePattern")
+	contextParamsKey       = NewContextKey[httprouter.Params]("params")
+	contextHandlerNameKey  = NewContextKey[string]("handlerName")
+)
+
+// ContextizeHandler adapts fn to an httprouter.Handle. The route params are
+// also stored in the context, for ParamsFromContext.
 func ContextizeHandler(ctx context.Context, fn ContextHandlerFunc) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
-		fn(ctx, w, req, params)
+		fn(contextParamsKey.Set(ctx, params), w, req, params)
+	}
+}
+
+// ContextizeRouteHandler is like ContextizeHandler, but also records the
+// route pattern the handler is registered under (e.g. "/users/:id") in the
+// context, where the logging middleware picks it up.
+func ContextizeRouteHandler(ctx context.Context, pattern string, fn ContextHandlerFunc) httprouter.Handle {
+	return ContextizeHandler(contextRoutePatternKey.Set(ctx, pattern), fn)
+}
+
+// ContextizeNamedHandler is like ContextizeHandler, but also records a
+// logical name for the handler in the context, which the logging middleware
+// adds to its lines as handler=name.
+func ContextizeNamedHandler(ctx context.Context, name string, fn ContextHandlerFunc) httprouter.Handle {
+	return ContextizeHandler(contextHandlerNameKey.Set(ctx, name), fn)
+}
+
+// HandlerNameFromContext returns the name recorded by
+// ContextizeNamedHandler, or an empty string if there is none.
+func HandlerNameFromContext(ctx context.Context) string {
+	name, _ := contextHandlerNameKey.Get(ctx)
+	return name
+}
+
+// GetRoutePatternFromContext returns the route pattern recorded by
+// ContextizeRouteHandler, or an empty string if there is none.
+func GetRoutePatternFromContext(ctx context.Context) string {
+	if pattern, ok := contextRoutePatternKey.Get(ctx); ok {
+		return pattern
+	}
+	return ""
+}
+
+// ParamsFromContext returns the route params stored by ContextizeHandler, or
+// empty params if there are none, so code that only has the context can
+// still read them.
+func ParamsFromContext(ctx context.Context) httprouter.Params {
+	if params, ok := contextParamsKey.Get(ctx); ok {
+		return params
 	}
+	return httprouter.Params{}
 }
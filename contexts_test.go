@@ -0,0 +1,70 @@
+package appkit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type contextsTestKey struct{}
+
+func TestContextizeHandlerPassesStdlibContext(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), contextsTestKey{}, "value"), deadline)
+	defer cancel()
+
+	var (
+		got       interface{}
+		gotDL     time.Time
+		gotParams httprouter.Params
+	)
+	ContextizeHandler(ctx, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		got = ctx.Value(contextsTestKey{})
+		gotDL, _ = ctx.Deadline()
+		gotParams = ParamsFromContext(ctx)
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil), httprouter.Params{{Key: "id", Value: "1"}})
+
+	if got != "value" {
+		t.Errorf("handler saw value %v, want %q", got, "value")
+	}
+	if !gotDL.Equal(deadline) {
+		t.Errorf("handler saw deadline %v, want %v", gotDL, deadline)
+	}
+	if gotParams.ByName("id") != "1" {
+		t.Errorf("handler saw params %v, want id=1", gotParams)
+	}
+}
+
+func TestRequestInfoSurvivesDerivedContexts(t *testing.T) {
+	cause := errors.New("shutting down")
+	var (
+		id, derivedID     string
+		logger, derivedLg *log.Logger
+		gotCause          error
+	)
+	serveLogged(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			id, logger = GetRequestIDFromContext(ctx), GetLoggerFromContext(ctx)
+
+			derived, cancel := context.WithCancelCause(context.WithoutCancel(context.WithValue(ctx, contextsTestKey{}, "x")))
+			cancel(cause)
+			derivedID, derivedLg = GetRequestIDFromContext(derived), GetLoggerFromContext(derived)
+			gotCause = context.Cause(derived)
+		})
+
+	if id != "req-1" || derivedID != id {
+		t.Errorf("request ID = %q, in derived context %q, want req-1 in both", id, derivedID)
+	}
+	if logger == nil || derivedLg != logger {
+		t.Error("derived context does not carry the request logger")
+	}
+	if gotCause != cause {
+		t.Errorf("context.Cause = %v, want %v", gotCause, cause)
+	}
+}
@@ -0,0 +1,129 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests,
+	// e.g. "https://example.com". "*" allows any origin, and a leading
+	// wildcard such as "https://*.example.com" allows any subdomain.
+	AllowedOrigins []string
+	// AllowedMethods lists the methods allowed in preflights. Defaults to
+	// GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers allowed in preflights. If
+	// empty, the headers the preflight asks for are allowed.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies or HTTP authentication.
+	// The allowed origin is then echoed back rather than sent as "*", as
+	// browsers require. It cannot be combined with an AllowedOrigins of
+	// "*", which would let any site make credentialed requests.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// WrapCORS adds CORS headers to responses for allowed origins, and answers
+// preflight requests itself with a 204. Preflights are OPTIONS requests, so
+// the handler must be registered for OPTIONS too, e.g. with router.OPTIONS
+// or router.GlobalOPTIONS. Place it inside WrapLoggingHandler so preflights
+// are logged like any other request.
+//
+// It panics if AllowCredentials is set and AllowedOrigins contains "*".
+func WrapCORS(opts CORSOptions, handler ContextHandlerFunc) ContextHandlerFunc {
+	if opts.AllowCredentials && opts.allowsAnyOrigin() {
+		panic(`appkit: CORS AllowCredentials cannot be used with AllowedOrigins "*"`)
+	}
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	allowedMethods := strings.Join(opts.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(opts.ExposedHeaders, ", ")
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		origin := req.Header.Get("Origin")
+		preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			handler(ctx, w, req, params)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		allowed := opts.allowsOrigin(origin)
+		if !allowed {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			handler(ctx, w, req, params)
+			return
+		}
+
+		if opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		} else if opts.allowsAnyOrigin() {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			handler(ctx, w, req, params)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", allowedMethods)
+		if allowedHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowedHeaders)
+		} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if opts.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (opts *CORSOptions) allowsAnyOrigin() bool {
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *CORSOptions) allowsOrigin(origin string) bool {
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if i := strings.Index(allowed, "*."); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapCORS(t *testing.T) {
+	opts := CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	tests := []struct {
+		name          string
+		method        string
+		origin        string
+		requestMethod string
+		wantStatus    int
+		wantHandler   bool
+		wantHeaders   map[string]string
+	}{
+		{
+			name:          "preflight from allowed origin",
+			method:        "OPTIONS",
+			origin:        "https://app.example.com",
+			requestMethod: "PUT",
+			wantStatus:    http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, PUT",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:          "preflight from subdomain wildcard",
+			method:        "OPTIONS",
+			origin:        "https://api.example.org",
+			requestMethod: "GET",
+			wantStatus:    http.StatusNoContent,
+			wantHeaders:   map[string]string{"Access-Control-Allow-Origin": "https://api.example.org"},
+		},
+		{
+			name:          "preflight from rejected origin",
+			method:        "OPTIONS",
+			origin:        "https://evil.example",
+			requestMethod: "PUT",
+			wantStatus:    http.StatusNoContent,
+			wantHeaders:   map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:        "wildcard does not match the bare domain",
+			method:      "GET",
+			origin:      "https://example.org",
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "simple request from allowed origin",
+			method:      "GET",
+			origin:      "https://app.example.com",
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "X-Total",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:        "same-origin request",
+			method:      "GET",
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			called := false
+			handler := WrapCORS(opts, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+				called = true
+			})
+			req := httptest.NewRequest(tc.method, "/items", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tc.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+			handler(context.Background(), rec, req, nil)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if called != tc.wantHandler {
+				t.Errorf("handler called = %t, want %t", called, tc.wantHandler)
+			}
+			for name, want := range tc.wantHeaders {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapCORSRejectsCredentialsWithAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WrapCORS did not panic")
+		}
+	}()
+	WrapCORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}, nil)
+}
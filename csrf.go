@@ -0,0 +1,138 @@
+package appkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultCSRFCookieName = "csrf_token"
+	defaultCSRFHeader     = "X-CSRF-Token"
+	defaultCSRFFormField  = "csrf_token"
+	csrfTokenBytes        = 32
+)
+
+// CSRFOptions configures the CSRF middleware.
+type CSRFOptions struct {
+	// Key signs the token cookie. It is required.
+	Key []byte
+	// CookieName defaults to csrf_token.
+	CookieName string
+	// Header carries the token on unsafe requests. Defaults to X-CSRF-Token.
+	Header string
+	// FormField carries the token in form posts when the header is absent.
+	// Defaults to csrf_token.
+	FormField string
+	// Path of the cookie. Defaults to "/".
+	Path string
+	// Secure limits the cookie to HTTPS.
+	Secure bool
+	// SameSite of the cookie. Defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+var contextCSRFTokenKey = NewContextKey[string]("csrfToken")
+
+// WrapCSRF protects against cross-site request forgery with signed
+// double-submit cookies. Every response that lacks a valid token cookie gets
+// a new one, and unsafe requests get a 403 unless they send the cookie's
+// token back in the header or form field. Handlers find the token with
+// CSRFTokenFromContext, e.g. to embed it in a form. It panics if opts.Key is
+// empty.
+func WrapCSRF(opts CSRFOptions, handler ContextHandlerFunc) ContextHandlerFunc {
+	if len(opts.Key) == 0 {
+		panic("appkit: CSRFOptions.Key is required")
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultCSRFCookieName
+	}
+	if opts.Header == "" {
+		opts.Header = defaultCSRFHeader
+	}
+	if opts.FormField == "" {
+		opts.FormField = defaultCSRFFormField
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		token, ok := opts.cookieToken(req)
+		if !ok {
+			var err error
+			if token, err = newCSRFToken(); err != nil {
+				GetLoggerFromContext(ctx).Printf("Failed to generate CSRF token: %s", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     opts.CookieName,
+				Value:    token + "." + opts.sign(token),
+				Path:     opts.Path,
+				Secure:   opts.Secure,
+				HttpOnly: true,
+				SameSite: opts.SameSite,
+			})
+		}
+
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			submitted := req.Header.Get(opts.Header)
+			if submitted == "" {
+				submitted = req.PostFormValue(opts.FormField)
+			}
+			if !ok || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				GetLoggerFromContext(ctx).Printf("CSRF token missing or invalid")
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+		handler(contextCSRFTokenKey.Set(ctx, token), w, req, params)
+	}
+}
+
+// CSRFTokenFromContext returns the token set by WrapCSRF, or an empty string
+// if there is none.
+func CSRFTokenFromContext(ctx context.Context) string {
+	token, _ := contextCSRFTokenKey.Get(ctx)
+	return token
+}
+
+// cookieToken returns the token from the request's cookie, if it is there
+// and correctly signed.
+func (opts *CSRFOptions) cookieToken(req *http.Request) (string, bool) {
+	cookie, err := req.Cookie(opts.CookieName)
+	if err != nil {
+		return "", false
+	}
+	token, sig, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(sig), []byte(opts.sign(token))) {
+		return "", false
+	}
+	return token, true
+}
+
+func (opts *CSRFOptions) sign(token string) string {
+	mac := hmac.New(sha256.New, opts.Key)
+	mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,70 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapCSRF(t *testing.T) {
+	opts := CSRFOptions{Key: []byte("test key")}
+	var seenToken string
+	handler := WrapCSRF(opts, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		seenToken = CSRFTokenFromContext(ctx)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(context.Background(), rec, httptest.NewRequest("GET", "/form", nil), nil)
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || seenToken == "" {
+		t.Fatalf("GET: status %d, cookies %v, token %q", rec.Code, cookies, seenToken)
+	}
+	cookie, token := cookies[0], seenToken
+	if !cookie.HttpOnly || !strings.HasPrefix(cookie.Value, token+".") {
+		t.Fatalf("cookie %v does not carry the signed token %q", cookie, token)
+	}
+	otherKey := &CSRFOptions{Key: []byte("other key")}
+
+	tests := []struct {
+		name       string
+		cookie     string
+		header     string
+		form       string
+		wantStatus int
+	}{
+		{"header matches", cookie.Value, token, "", http.StatusOK},
+		{"form field matches", cookie.Value, "", token, http.StatusOK},
+		{"mismatch", cookie.Value, "not the token", "", http.StatusForbidden},
+		{"no token sent", cookie.Value, "", "", http.StatusForbidden},
+		{"no cookie", "", token, "", http.StatusForbidden},
+		{"tampered signature", token + ".forged", token, "", http.StatusForbidden},
+		{"signed with another key", token + "." + otherKey.sign(token), token, "", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var req *http.Request
+			if tc.form != "" {
+				req = httptest.NewRequest("POST", "/form", strings.NewReader(url.Values{"csrf_token": {tc.form}}.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest("POST", "/form", nil)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: cookie.Name, Value: tc.cookie})
+			}
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(context.Background(), rec, req, nil)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// WrapCancelOnDisconnect cancels the context passed to handler when the
+// client goes away, so that expensive work can be abandoned. It has no effect
+// if the response writer is not an http.CloseNotifier.
+func WrapCancelOnDisconnect(handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		notifier, ok := w.(http.CloseNotifier)
+		if !ok {
+			handler(ctx, w, req, params)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		closed := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-closed:
+				GetLoggerFromContext(ctx).Print("client disconnected")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		handler(ctx, w, req, params)
+	}
+}
@@ -0,0 +1,56 @@
+package appkit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const maxDumpBodyBytes = 64 << 10
+
+// dumpRequest returns the lines of a dump of req, with headers and query
+// parameters redacted as for the access log. If withBody is set, the start
+// of the body is included and req.Body is replaced so the handler can still
+// read all of it.
+func dumpRequest(req *http.Request, opts *Options, withBody bool) []string {
+	lines := []string{
+		fmt.Sprintf("%s %s %s", req.Method, redactURL(req.URL, opts.RedactQueryParams), req.Proto),
+		"Host: " + req.Host,
+	}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			lines = append(lines, name+": "+redactHeaderValue(name, value, opts.RedactHeaders))
+		}
+	}
+
+	if withBody && req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxDumpBodyBytes))
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(string(body), "\n")...)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("(error reading body: %s)", err))
+		}
+	}
+
+	// Everything here comes from the client, so escape it as for the
+	// access log.
+	for i, line := range lines {
+		lines[i] = escapeControlChars(line)
+	}
+	return lines
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
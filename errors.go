@@ -0,0 +1,129 @@
+package appkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ErrorHandlerFunc is a ContextHandlerFunc that returns an error instead of
+// writing its own error response.
+type ErrorHandlerFunc func(
+	ctx context.Context,
+	w http.ResponseWriter,
+	req *http.Request,
+	params httprouter.Params) error
+
+// ErrorRenderer maps an error returned by a handler to the status and body of
+// the response.
+type ErrorRenderer func(err error) (status int, body string)
+
+// Sentinel errors that DefaultErrorStatuses maps to their statuses.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+)
+
+// StatusError is an error that carries the status it should be rendered
+// with.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// NewStatusError returns a *StatusError with a formatted message.
+func NewStatusError(code int, format string, args ...interface{}) error {
+	return &StatusError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// ErrorStatus maps errors matching Err, with errors.Is, to Status.
+type ErrorStatus struct {
+	Err    error
+	Status int
+}
+
+// ErrorStatuses maps errors to response statuses. Entries are tried in
+// order, so an error matching several, such as one built with errors.Join,
+// gets the status of the first.
+type ErrorStatuses []ErrorStatus
+
+// DefaultErrorStatuses maps the package's sentinel errors.
+var DefaultErrorStatuses = ErrorStatuses{
+	{ErrBadRequest, http.StatusBadRequest},
+	{ErrUnauthorized, http.StatusUnauthorized},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrConflict, http.StatusConflict},
+}
+
+// Status returns the status for err: the code of a *StatusError in its
+// chain, else the status of the first matching entry, else 500.
+func (m ErrorStatuses) Status(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	for _, entry := range m {
+		if errors.Is(err, entry.Err) {
+			return entry.Status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// NewErrorRenderer returns an ErrorRenderer that picks the status with
+// statuses.Status and uses the error message as the body.
+func NewErrorRenderer(statuses ErrorStatuses) ErrorRenderer {
+	return func(err error) (int, string) {
+		return statuses.Status(err), err.Error()
+	}
+}
+
+// DefaultErrorRenderer renders with DefaultErrorStatuses, responding with
+// 500 for errors it does not know.
+func DefaultErrorRenderer(err error) (int, string) {
+	return DefaultErrorStatuses.Status(err), err.Error()
+}
+
+// WrapErrorHandler adapts fn to a ContextHandlerFunc. An error returned by fn
+// is logged, recorded for the end line with SetRequestError and, if fn has
+// not written a response yet or it can be rolled back (see
+// WrapBufferHandler), rendered with renderer, or DefaultErrorRenderer if it
+// is nil.
+func WrapErrorHandler(fn ErrorHandlerFunc, renderer ErrorRenderer) ContextHandlerFunc {
+	if renderer == nil {
+		renderer = DefaultErrorRenderer
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		logger := getLeveledLoggerFromContext(ctx)
+		loggingW := ensureLoggingResponseWriter(w, logger)
+		err := fn(ctx, loggingW, req, params)
+		if err == nil {
+			return
+		}
+		SetRequestError(ctx, err)
+		status, body := renderer(err)
+		logAtLevel(logger, levelForStatus(status), "Handler error: "+err.Error(), "status", status)
+		if loggingW.WroteHeader() && !loggingW.rollback() {
+			return
+		}
+		http.Error(loggingW, body, status)
+	}
+}
@@ -0,0 +1,26 @@
+package appkit
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestErrorStatusesFirstMatchWins(t *testing.T) {
+	err := errors.Join(ErrNotFound, ErrForbidden)
+	for i := 0; i < 100; i++ {
+		if got := DefaultErrorStatuses.Status(err); got != http.StatusForbidden {
+			t.Fatalf("Status() = %d, want %d", got, http.StatusForbidden)
+		}
+	}
+}
+
+func TestErrorStatusesStatusError(t *testing.T) {
+	err := errors.Join(ErrNotFound, NewStatusError(http.StatusTeapot, "short and stout"))
+	if got := DefaultErrorStatuses.Status(err); got != http.StatusTeapot {
+		t.Errorf("Status() = %d, want %d", got, http.StatusTeapot)
+	}
+	if got := DefaultErrorStatuses.Status(errors.New("other")); got != http.StatusInternalServerError {
+		t.Errorf("Status() = %d, want %d", got, http.StatusInternalServerError)
+	}
+}
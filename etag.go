@@ -0,0 +1,149 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const defaultETagMaxSize = 1 << 20
+
+// ETagOptions configures the ETag middleware.
+type ETagOptions struct {
+	// MaxSize is the largest response body, in bytes, that is buffered to
+	// compute an ETag. Larger responses are streamed without one. Defaults
+	// to 1MB.
+	MaxSize int
+}
+
+// WrapETagHandler adds an ETag computed from the body to successful GET
+// responses that do not already set one, and answers a matching
+// If-None-Match with a 304 and no body. Place it inside WrapLoggingHandler so
+// the logged size is what was actually sent.
+func WrapETagHandler(handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapETagHandlerWithOptions(handler, ETagOptions{})
+}
+
+func WrapETagHandlerWithOptions(handler ContextHandlerFunc, opts ETagOptions) ContextHandlerFunc {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultETagMaxSize
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if req.Method != http.MethodGet {
+			handler(ctx, w, req, params)
+			return
+		}
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		etagW := &etagResponseWriter{w: loggingW, opts: &opts}
+		handler(ctx, etagW, req, params)
+		etagW.close(req.Header.Get("If-None-Match"))
+	}
+}
+
+// etagResponseWriter buffers the response until the handler returns, unless
+// it grows past MaxSize or is flushed, in which case it is sent as is.
+type etagResponseWriter struct {
+	w         loggingResponseWriter
+	opts      *ETagOptions
+	status    int
+	buf       bytes.Buffer
+	committed bool
+}
+
+func (e *etagResponseWriter) Header() http.Header {
+	return e.w.Header()
+}
+
+func (e *etagResponseWriter) WriteHeader(status int) {
+	if e.committed {
+		e.w.WriteHeader(status)
+		return
+	}
+	if e.status == 0 {
+		e.status = status
+	}
+}
+
+func (e *etagResponseWriter) Write(b []byte) (int, error) {
+	if e.committed {
+		return e.w.Write(b)
+	}
+	if e.status == 0 {
+		e.status = http.StatusOK
+	}
+	e.buf.Write(b)
+	if e.buf.Len() > e.opts.MaxSize {
+		if err := e.commit(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (e *etagResponseWriter) Flush() {
+	if !e.committed {
+		e.commit()
+	}
+	e.w.Flush()
+}
+
+// commit sends the status and whatever has been buffered.
+func (e *etagResponseWriter) commit() error {
+	e.committed = true
+	if e.status == 0 {
+		e.status = http.StatusOK
+	}
+	e.w.WriteHeader(e.status)
+	if e.buf.Len() == 0 {
+		return nil
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	e.buf.Reset()
+	return err
+}
+
+func (e *etagResponseWriter) close(ifNoneMatch string) {
+	if e.committed {
+		return
+	}
+	if e.status == 0 && e.buf.Len() == 0 {
+		// The handler wrote nothing; leave the response to net/http.
+		return
+	}
+	h := e.w.Header()
+	if e.status == http.StatusOK {
+		if h.Get("ETag") == "" {
+			sum := sha256.Sum256(e.buf.Bytes())
+			h.Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:16])+`"`)
+		}
+		if etagMatches(ifNoneMatch, h.Get("ETag")) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			e.committed = true
+			e.w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	e.commit()
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison that RFC 9110 specifies for If-None-Match.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapETagHandler(t *testing.T) {
+	handler := WrapETagHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	})
+	serve := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/greeting", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler(context.Background(), rec, req, nil)
+		return rec
+	}
+
+	first := serve("GET", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.String() != "hello" {
+		t.Fatalf("first GET: status %d, ETag %q, body %q", first.Code, etag, first.Body.String())
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"matching", "GET", etag, http.StatusNotModified, ""},
+		{"weak match", "GET", "W/" + etag, http.StatusNotModified, ""},
+		{"one of several", "GET", `"other", ` + etag, http.StatusNotModified, ""},
+		{"any", "GET", "*", http.StatusNotModified, ""},
+		{"stale", "GET", `"stale"`, http.StatusOK, "hello"},
+		{"not a GET", "POST", etag, http.StatusOK, "hello"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(tc.method, tc.ifNoneMatch)
+			if rec.Code != tc.wantStatus || rec.Body.String() != tc.wantBody {
+				t.Errorf("got status %d, body %q, want %d, %q", rec.Code, rec.Body.String(), tc.wantStatus, tc.wantBody)
+			}
+			if rec.Code == http.StatusNotModified && rec.Header().Get("Content-Type") != "" {
+				t.Errorf("304 kept Content-Type %q", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestWrapETagHandlerSkipsLargeResponses(t *testing.T) {
+	handler := WrapETagHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		w.Write(make([]byte, 64))
+	}, ETagOptions{MaxSize: 16})
+	rec := httptest.NewRecorder()
+	handler(context.Background(), rec, httptest.NewRequest("GET", "/", nil), nil)
+	if rec.Header().Get("ETag") != "" || rec.Body.Len() != 64 {
+		t.Errorf("large response got ETag %q and %d bytes", rec.Header().Get("ETag"), rec.Body.Len())
+	}
+}
@@ -0,0 +1,35 @@
+package appkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// DefaultFingerprint is a fingerprint attribute set that groups retries of
+// the same request by clients that send an Idempotency-Key.
+var DefaultFingerprint = []string{"method", "path", "Idempotency-Key"}
+
+// fingerprint returns the first 8 hex digits of a SHA-256 over the named
+// attributes of req. An attribute is "method", "path", "query" or the name
+// of a request header.
+func fingerprint(req *http.Request, attrs []string) string {
+	h := sha256.New()
+	for _, attr := range attrs {
+		var value string
+		switch attr {
+		case "method":
+			value = req.Method
+		case "path":
+			value = req.URL.Path
+		case "query":
+			value = req.URL.RawQuery
+		default:
+			value = strings.Join(req.Header.Values(attr), ",")
+		}
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
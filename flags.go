@@ -0,0 +1,69 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// FlagSet holds the feature flags evaluated for a request.
+type FlagSet map[string]bool
+
+// Enabled reports whether the named flag is on. It is false for unknown
+// flags and for a nil FlagSet.
+func (f FlagSet) Enabled(name string) bool {
+	return f[name]
+}
+
+// FlagEvaluator decides the feature flags for a request. The context carries
+// whatever outer middleware stored, such as UserFromContext.
+type FlagEvaluator interface {
+	Evaluate(ctx context.Context, req *http.Request) FlagSet
+}
+
+// FlagEvaluatorFunc adapts a function to a FlagEvaluator.
+type FlagEvaluatorFunc func(ctx context.Context, req *http.Request) FlagSet
+
+func (f FlagEvaluatorFunc) Evaluate(ctx context.Context, req *http.Request) FlagSet {
+	return f(ctx, req)
+}
+
+// FlagOptions configures the feature flag middleware.
+type FlagOptions struct {
+	// LogFlags logs the enabled flags of each request at LevelDebug.
+	LogFlags bool
+}
+
+var contextFlagsKey = NewContextKey[FlagSet]("flags")
+
+// WrapFlags evaluates feature flags once per request and stores them for
+// FlagsFromContext.
+func WrapFlags(evaluator FlagEvaluator, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapFlagsWithOptions(evaluator, handler, FlagOptions{})
+}
+
+func WrapFlagsWithOptions(evaluator FlagEvaluator, handler ContextHandlerFunc, opts FlagOptions) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		flags := evaluator.Evaluate(ctx, req)
+		if opts.LogFlags {
+			enabled := make([]string, 0, len(flags))
+			for name, on := range flags {
+				if on {
+					enabled = append(enabled, name)
+				}
+			}
+			sort.Strings(enabled)
+			getLeveledLoggerFromContext(ctx).Debug("Feature flags", "enabled", enabled)
+		}
+		handler(contextFlagsKey.Set(ctx, flags), w, req, params)
+	}
+}
+
+// FlagsFromContext returns the flags evaluated by WrapFlags, or nil, whose
+// flags are all off, if there are none.
+func FlagsFromContext(ctx context.Context) FlagSet {
+	flags, _ := contextFlagsKey.Get(ctx)
+	return flags
+}
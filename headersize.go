@@ -0,0 +1,37 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// WrapMaxHeaderBytes answers requests whose headers total more than
+// maxBytes with a 431, logging the largest header so that the culprit, often
+// an oversized cookie, can be found. The size counts each header name and
+// value, once per value. It is for limiting particular routes below the
+// server-wide http.Server.MaxHeaderBytes, which also bounds the request line
+// and is enforced before any handler runs.
+func WrapMaxHeaderBytes(maxBytes int, handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		total, largest, largestSize := 0, "", 0
+		for name, values := range req.Header {
+			size := 0
+			for _, value := range values {
+				size += len(name) + len(value)
+			}
+			total += size
+			if size > largestSize {
+				largest, largestSize = name, size
+			}
+		}
+		if total > maxBytes {
+			GetLoggerFromContext(ctx).Printf("Request headers are %d bytes, over the limit of %d; largest is %s at %d bytes",
+				total, maxBytes, escapeControlChars(largest), largestSize)
+			http.Error(w, http.StatusText(http.StatusRequestHeaderFieldsTooLarge), http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		handler(ctx, w, req, params)
+	}
+}
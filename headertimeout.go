@@ -0,0 +1,52 @@
+package appkit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTimeoutHeader    = "X-Timeout-Ms"
+	defaultHeaderTimeoutMax = time.Minute
+)
+
+// HeaderTimeoutOptions configures the header timeout middleware.
+type HeaderTimeoutOptions struct {
+	// Header carries the timeout in milliseconds. Defaults to X-Timeout-Ms.
+	Header string
+	// Default is the timeout for requests without a valid header. Zero means
+	// no timeout.
+	Default time.Duration
+	// Max caps the timeout a client can ask for. Defaults to one minute.
+	Max time.Duration
+	// Status is the response status on timeout. Defaults to 504 Gateway
+	// Timeout.
+	Status int
+}
+
+// WrapHeaderTimeoutHandler is like WrapTimeoutHandler, but takes the timeout
+// from a request header, for trusted callers that propagate their own
+// deadlines. Missing, malformed, zero and negative values get the default timeout,
+// and values above the maximum are capped.
+func WrapHeaderTimeoutHandler(opts HeaderTimeoutOptions, handler ContextHandlerFunc) ContextHandlerFunc {
+	if opts.Header == "" {
+		opts.Header = defaultTimeoutHeader
+	}
+	if opts.Max <= 0 {
+		opts.Max = defaultHeaderTimeoutMax
+	}
+	if opts.Status == 0 {
+		opts.Status = http.StatusGatewayTimeout
+	}
+	return wrapTimeout(func(req *http.Request) time.Duration {
+		ms, err := strconv.ParseInt(req.Header.Get(opts.Header), 10, 64)
+		if err != nil || ms <= 0 {
+			return opts.Default
+		}
+		if ms > int64(opts.Max/time.Millisecond) {
+			return opts.Max
+		}
+		return time.Duration(ms) * time.Millisecond
+	}, handler, opts.Status)
+}
@@ -0,0 +1,78 @@
+package appkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// HealthHandler always responds 200 with {"status":"ok"}, for liveness
+// probes. Use WithSkipPaths to keep probes out of the access log.
+func HealthHandler(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	writeHealthResponse(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// ReadinessHandler returns a handler that runs checks on each request and
+// responds 200 if they all pass, or 503 listing the failed checks if not.
+// Failed checks are named by NamedCheck, or else by their position; their
+// errors are logged rather than sent to the client.
+func ReadinessHandler(checks ...func() error) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		var failed []string
+		for i, check := range checks {
+			if err := check(); err != nil {
+				name := "check " + strconv.Itoa(i+1)
+				var named *namedCheckError
+				if errors.As(err, &named) {
+					name = named.name
+				}
+				GetLoggerFromContext(ctx).Printf("Readiness check %s failed: %s", name, err)
+				failed = append(failed, name)
+			}
+		}
+		if len(failed) > 0 {
+			writeHealthResponse(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Failed: failed})
+			return
+		}
+		writeHealthResponse(w, http.StatusOK, healthResponse{Status: "ok"})
+	}
+}
+
+// NamedCheck names check for ReadinessHandler's failure reports.
+func NamedCheck(name string, check func() error) func() error {
+	return func() error {
+		if err := check(); err != nil {
+			return &namedCheckError{name: name, err: err}
+		}
+		return nil
+	}
+}
+
+type namedCheckError struct {
+	name string
+	err  error
+}
+
+func (e *namedCheckError) Error() string {
+	return e.err.Error()
+}
+
+func (e *namedCheckError) Unwrap() error {
+	return e.err
+}
+
+type healthResponse struct {
+	Status string   `json:"status"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+func writeHealthResponse(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,156 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultIdempotencyHeader = "Idempotency-Key"
+	defaultIdempotencyTTL    = 24 * time.Hour
+	defaultStoreMaxSize      = 1 << 20
+)
+
+// IdempotencyOptions configures the idempotency middleware.
+type IdempotencyOptions struct {
+	// Header carries the client's idempotency key. Defaults to
+	// Idempotency-Key.
+	Header string
+	// TTL is how long responses are kept. Defaults to 24 hours.
+	TTL time.Duration
+	// MaxSize is the largest response body, in bytes, that is stored.
+	// Larger responses are sent but not replayed. Defaults to 1MB.
+	MaxSize int
+}
+
+// WrapIdempotency replays the stored response, rather than running handler
+// again, when a client retries an unsafe request with the same idempotency
+// key. Keys are scoped to the method and path. Requests without a key, safe
+// methods and 5xx responses are never stored, so server errors can be
+// retried.
+//
+// While a request with a given key is running, concurrent requests with the
+// same key get a 409 instead of running the handler a second time. That is
+// only enforced within one process: with a store shared between instances,
+// simultaneous first requests that reach different instances can both run.
+func WrapIdempotency(store ResponseStore, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapIdempotencyWithOptions(store, handler, IdempotencyOptions{})
+}
+
+func WrapIdempotencyWithOptions(store ResponseStore, handler ContextHandlerFunc, opts IdempotencyOptions) ContextHandlerFunc {
+	if opts.Header == "" {
+		opts.Header = defaultIdempotencyHeader
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultIdempotencyTTL
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultStoreMaxSize
+	}
+	var mu sync.Mutex
+	inFlight := make(map[string]bool)
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		clientKey := req.Header.Get(opts.Header)
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			clientKey = ""
+		}
+		if clientKey == "" {
+			handler(ctx, w, req, params)
+			return
+		}
+		key := req.Method + " " + req.URL.Path + " " + clientKey
+
+		// The store is checked under the lock, after the in-flight check, so
+		// that a request finishing between the two cannot let a retry run
+		// the handler again.
+		mu.Lock()
+		if inFlight[key] {
+			mu.Unlock()
+			GetLoggerFromContext(ctx).Printf("Request with idempotency key %q already in progress", clientKey)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+		if resp, ok := store.Get(key); ok {
+			mu.Unlock()
+			GetLoggerFromContext(ctx).Printf("Replaying response for idempotency key %q", clientKey)
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeStoredResponse(w, resp)
+			return
+		}
+		inFlight[key] = true
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			delete(inFlight, key)
+			mu.Unlock()
+		}()
+
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		captureW := &captureWriter{loggingResponseWriter: loggingW, maxSize: opts.MaxSize}
+		handler(ctx, captureW, req, params)
+		if resp, ok := captureW.response(); ok && resp.Status < 500 {
+			store.Set(key, resp, opts.TTL)
+		}
+	}
+}
+
+// writeStoredResponse replays resp to w. Headers already set on w, such as
+// the new request's ID, are kept rather than replayed.
+func writeStoredResponse(w http.ResponseWriter, resp *StoredResponse) {
+	header := w.Header()
+	for name, values := range resp.Header {
+		if _, ok := header[name]; !ok {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// captureWriter keeps a copy of the response as it is written, for storing.
+// The copy is abandoned if the body grows past maxSize or cannot be seen,
+// as when it is sent with ReadFrom.
+type captureWriter struct {
+	loggingResponseWriter
+	maxSize  int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	n, err := c.loggingResponseWriter.Write(b)
+	if !c.overflow {
+		if c.body.Len()+n > c.maxSize {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(b[:n])
+		}
+	}
+	return n, err
+}
+
+func (c *captureWriter) ReadFrom(r io.Reader) (int64, error) {
+	c.overflow = true
+	c.body = bytes.Buffer{}
+	return c.loggingResponseWriter.ReadFrom(r)
+}
+
+// response returns the captured response, if it was captured in full.
+func (c *captureWriter) response() (*StoredResponse, bool) {
+	if c.overflow || !c.WroteHeader() {
+		return nil, false
+	}
+	return &StoredResponse{
+		Status: c.Status(),
+		Header: c.HeaderSnapshot(),
+		Body:   bytes.Clone(c.body.Bytes()),
+	}, true
+}
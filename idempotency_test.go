@@ -0,0 +1,137 @@
+package appkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapIdempotency(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		requests   [][3]string // method, path, key
+		wantCalls  int
+		wantReplay []bool
+	}{
+		{
+			name:       "retry is replayed",
+			status:     http.StatusCreated,
+			requests:   [][3]string{{"POST", "/orders", "k1"}, {"POST", "/orders", "k1"}},
+			wantCalls:  1,
+			wantReplay: []bool{false, true},
+		},
+		{
+			name:       "keys are scoped to the path",
+			status:     http.StatusCreated,
+			requests:   [][3]string{{"POST", "/orders", "k1"}, {"POST", "/refunds", "k1"}},
+			wantCalls:  2,
+			wantReplay: []bool{false, false},
+		},
+		{
+			name:       "server errors can be retried",
+			status:     http.StatusBadGateway,
+			requests:   [][3]string{{"POST", "/orders", "k1"}, {"POST", "/orders", "k1"}},
+			wantCalls:  2,
+			wantReplay: []bool{false, false},
+		},
+		{
+			name:       "safe methods are not stored",
+			status:     http.StatusOK,
+			requests:   [][3]string{{"GET", "/orders", "k1"}, {"GET", "/orders", "k1"}},
+			wantCalls:  2,
+			wantReplay: []bool{false, false},
+		},
+		{
+			name:       "requests without a key are not stored",
+			status:     http.StatusCreated,
+			requests:   [][3]string{{"POST", "/orders", ""}, {"POST", "/orders", ""}},
+			wantCalls:  2,
+			wantReplay: []bool{false, false},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			handler := WrapIdempotency(NewMemoryStore(), func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+				calls++
+				w.Header().Set("Location", fmt.Sprintf("/orders/%d", calls))
+				w.WriteHeader(tc.status)
+				fmt.Fprintf(w, "call %d", calls)
+			})
+			for i, r := range tc.requests {
+				req := httptest.NewRequest(r[0], r[1], nil)
+				if r[2] != "" {
+					req.Header.Set("Idempotency-Key", r[2])
+				}
+				rec := httptest.NewRecorder()
+				handler(context.Background(), rec, req, nil)
+
+				replayed := rec.Header().Get("Idempotent-Replayed") == "true"
+				if replayed != tc.wantReplay[i] {
+					t.Errorf("request %d: replayed = %t, want %t", i+1, replayed, tc.wantReplay[i])
+				}
+				if replayed && (rec.Code != tc.status || rec.Body.String() != "call 1" || rec.Header().Get("Location") != "/orders/1") {
+					t.Errorf("request %d: replayed %d %q with Location %q, want the first response",
+						i+1, rec.Code, rec.Body.String(), rec.Header().Get("Location"))
+				}
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("handler ran %d times, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWrapIdempotencyConcurrentKey(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := WrapIdempotency(NewMemoryStore(), func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("POST", "/orders", nil)
+		req.Header.Set("Idempotency-Key", "k1")
+		return req
+	}
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(context.Background(), first, newRequest(), nil)
+		close(done)
+	}()
+	<-started
+
+	second := httptest.NewRecorder()
+	handler(context.Background(), second, newRequest(), nil)
+	if second.Code != http.StatusConflict {
+		t.Errorf("concurrent request got %d, want %d", second.Code, http.StatusConflict)
+	}
+
+	close(release)
+	<-done
+	third := httptest.NewRecorder()
+	handler(context.Background(), third, newRequest(), nil)
+	if third.Code != http.StatusCreated || third.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry after completion got %d, replayed %q, want a replayed 201", third.Code, third.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("fresh", &StoredResponse{Status: http.StatusOK}, time.Minute)
+	store.Set("stale", &StoredResponse{Status: http.StatusOK}, -time.Second)
+	if _, ok := store.Get("fresh"); !ok {
+		t.Error("fresh entry is missing")
+	}
+	if _, ok := store.Get("stale"); ok {
+		t.Error("expired entry was returned")
+	}
+}
@@ -0,0 +1,73 @@
+package appkit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// IPRules decides which client IPs WrapIPFilter lets through. Entries are
+// IP addresses or CIDR ranges, e.g. "10.0.0.0/8".
+type IPRules struct {
+	// Allow, if not empty, lets through only clients in these ranges.
+	Allow []string
+	// Deny blocks clients in these ranges, even if Allow matches them.
+	Deny []string
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For or
+	// X-Real-IP when the request comes from one of TrustedProxies, as the
+	// logging middleware's option of the same name does.
+	TrustProxyHeaders bool
+	// TrustedProxies lists the IP addresses or CIDR ranges of the proxies in
+	// front of the server. Defaults to DefaultTrustedProxies.
+	TrustedProxies []string
+}
+
+// WrapIPFilter answers requests from clients that rules block with a 403.
+// It panics if a rule is not a valid IP or CIDR range.
+func WrapIPFilter(rules IPRules, handler ContextHandlerFunc) ContextHandlerFunc {
+	allow := mustParseIPNets(rules.Allow)
+	deny := mustParseIPNets(rules.Deny)
+	trusted := trustedProxyNets(rules.TrustProxyHeaders, rules.TrustedProxies)
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ip := clientIP(req, trusted)
+		parsed := net.ParseIP(ip)
+		if parsed == nil || (len(allow) > 0 && !ipNetsContain(allow, parsed)) || ipNetsContain(deny, parsed) {
+			GetLoggerFromContext(ctx).Printf("Blocked request from %s by IP filter", ip)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler(ctx, w, req, params)
+	}
+}
+
+func mustParseIPNets(rules []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(rules))
+	for _, rule := range rules {
+		if ip := net.ParseIP(rule); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(rule)
+		if err != nil {
+			panic(fmt.Sprintf("appkit: invalid IP rule %q: %s", rule, err))
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func ipNetsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
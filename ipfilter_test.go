@@ -0,0 +1,71 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapIPFilter(t *testing.T) {
+	rules := IPRules{
+		Allow: []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"},
+		Deny:  []string{"10.1.0.0/16"},
+	}
+	tests := []struct {
+		name         string
+		rules        IPRules
+		remoteAddr   string
+		forwardedFor string
+		wantStatus   int
+		wantHandler  bool
+	}{
+		{"allowed range", rules, "10.2.3.4:1234", "", http.StatusOK, true},
+		{"allowed single address", rules, "192.0.2.7:1234", "", http.StatusOK, true},
+		{"allowed IPv6 range", rules, "[2001:db8::1]:1234", "", http.StatusOK, true},
+		{"outside allow", rules, "192.0.2.8:1234", "", http.StatusForbidden, false},
+		{"deny wins over allow", rules, "10.1.2.3:1234", "", http.StatusForbidden, false},
+		{"deny only", IPRules{Deny: []string{"203.0.113.0/24"}}, "203.0.113.9:1234", "", http.StatusForbidden, false},
+		{"not denied", IPRules{Deny: []string{"203.0.113.0/24"}}, "198.51.100.1:1234", "", http.StatusOK, true},
+		{"proxy headers ignored by default", rules, "10.2.3.4:1234", "10.1.2.3", http.StatusOK, true},
+		{
+			"client behind trusted proxy",
+			IPRules{Deny: []string{"203.0.113.0/24"}, TrustProxyHeaders: true},
+			"127.0.0.1:1234", "203.0.113.9", http.StatusForbidden, false,
+		},
+		{
+			"spoofed hop ahead of the client",
+			IPRules{Allow: []string{"192.0.2.7"}, TrustProxyHeaders: true},
+			"127.0.0.1:1234", "192.0.2.7, 198.51.100.1", http.StatusForbidden, false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			called := false
+			handler := WrapIPFilter(tc.rules, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+				called = true
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			rec := httptest.NewRecorder()
+			handler(context.Background(), rec, req, nil)
+			if rec.Code != tc.wantStatus || called != tc.wantHandler {
+				t.Errorf("got status %d, handler called %t, want %d, %t", rec.Code, called, tc.wantStatus, tc.wantHandler)
+			}
+		})
+	}
+}
+
+func TestWrapIPFilterRejectsInvalidRules(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WrapIPFilter did not panic")
+		}
+	}()
+	WrapIPFilter(IPRules{Allow: []string{"10.0.0.0/33"}}, nil)
+}
@@ -0,0 +1,62 @@
+package appkit
+
+import (
+	"log"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// LineFormatter returns the text of a start or end line, for full control
+// over the access log; see Options.LineFormatter. Returning an empty string
+// suppresses the line.
+type LineFormatter func(line LogLine) string
+
+// LogLine holds what is known about a request when its start or end line is
+// written. Values that come from the request are escaped and redacted as
+// for the built-in formats.
+type LogLine struct {
+	// Start is true for the start line and false for the end line.
+	Start     bool
+	Time      time.Time
+	Level     Level
+	RequestID string
+	Method    string
+	// URL is the path and query; Path and Query are also given separately.
+	URL      string
+	Path     string
+	Query    string
+	Route    string
+	Handler  string
+	Params   httprouter.Params
+	ClientIP string
+	// Status, Size, Duration and Error are only set on the end line. Error
+	// is the error recorded with SetRequestError, if any.
+	Status   int
+	Size     int64
+	Duration time.Duration
+	Error    string
+}
+
+func (entry *logEntry) logLine(timestamp time.Time, level Level, start bool) LogLine {
+	return LogLine{
+		Start:     start,
+		Time:      timestamp,
+		Level:     level,
+		RequestID: entry.id,
+		Method:    entry.method,
+		URL:       entry.url,
+		Path:      entry.path,
+		Query:     entry.query,
+		Route:     entry.route,
+		Handler:   entry.handler,
+		Params:    entry.params,
+		ClientIP:  entry.clientIP,
+	}
+}
+
+func writeFormattedLine(logger *log.Logger, formatter LineFormatter, line LogLine) {
+	if text := formatter(line); text != "" {
+		logger.Print(text)
+	}
+}
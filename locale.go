@@ -0,0 +1,59 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/text/language"
+)
+
+// LocaleOptions configures the locale middleware.
+type LocaleOptions struct {
+	// Supported are the locales the application can serve, in order of
+	// preference.
+	Supported []language.Tag
+	// Default is the locale used when the client accepts none of the
+	// supported ones. Defaults to the first supported locale.
+	Default language.Tag
+}
+
+// Locale is the result of negotiating a request's Accept-Language header.
+type Locale struct {
+	// Tag is the best supported match for the client's preferences.
+	Tag language.Tag
+	// Preferences are the client's accepted languages, most preferred first.
+	Preferences []language.Tag
+}
+
+var contextLocaleKey = NewContextKey[Locale]("locale")
+
+// WrapLocaleHandler matches the Accept-Language header against the supported
+// locales and stores the result for LocaleFromContext. The chosen locale is
+// also added to the context logger as a field.
+func WrapLocaleHandler(opts LocaleOptions, handler ContextHandlerFunc) ContextHandlerFunc {
+	if opts.Default == language.Und && len(opts.Supported) > 0 {
+		opts.Default = opts.Supported[0]
+	}
+	matcher := language.NewMatcher(opts.Supported)
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		locale := Locale{Tag: opts.Default}
+		if header := req.Header.Get("Accept-Language"); header != "" {
+			locale.Preferences, _, _ = language.ParseAcceptLanguage(header)
+		}
+		if len(locale.Preferences) > 0 && len(opts.Supported) > 0 {
+			if _, index, confidence := matcher.Match(locale.Preferences...); confidence != language.No {
+				locale.Tag = opts.Supported[index]
+			}
+		}
+		ctx = contextLocaleKey.Set(ctx, locale)
+		ctx = WithLoggerField(ctx, "locale", locale.Tag)
+		handler(ctx, w, req, params)
+	}
+}
+
+// LocaleFromContext returns the locale negotiated by WrapLocaleHandler, and
+// whether there was one.
+func LocaleFromContext(ctx context.Context) (Locale, bool) {
+	return contextLocaleKey.Get(ctx)
+}
@@ -0,0 +1,220 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// ParseLevel returns the level named by s, e.g. "info" or "WARN".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("appkit: unknown log level %q", s)
+}
+
+// Logger is a leveled logger. The optional keyvals are alternating keys and
+// values that are attached to the line.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NewStdLogger returns a Logger that writes to l, prefixing each line with
+// the level name and appending keyvals as key=value pairs.
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s *stdLogger) Debug(msg string, keyvals ...interface{}) {
+	s.log(LevelDebug, msg, keyvals)
+}
+
+func (s *stdLogger) Info(msg string, keyvals ...interface{}) {
+	s.log(LevelInfo, msg, keyvals)
+}
+
+func (s *stdLogger) Warn(msg string, keyvals ...interface{}) {
+	s.log(LevelWarn, msg, keyvals)
+}
+
+func (s *stdLogger) Error(msg string, keyvals ...interface{}) {
+	s.log(LevelError, msg, keyvals)
+}
+
+func (s *stdLogger) log(level Level, msg string, keyvals []interface{}) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(level.String())
+	buf.WriteString(" ")
+	buf.WriteString(msg)
+	writeKeyvals(buf, keyvals)
+	s.l.Print(buf.String())
+}
+
+// writeKeyvals appends keyvals to buf as space-separated key=value pairs.
+// Keys and values that contain spaces, quotes, '=' or control characters
+// are quoted, so that values from the request cannot break the line or
+// forge pairs.
+func writeKeyvals(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteString(" ")
+		buf.WriteString(keyvalString(keyvals[i]))
+		buf.WriteString("=")
+		if i+1 < len(keyvals) {
+			buf.WriteString(keyvalString(keyvals[i+1]))
+		}
+	}
+}
+
+func keyvalString(v interface{}) string {
+	s := fmt.Sprint(v)
+	if strings.IndexFunc(s, needsKeyvalQuote) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func needsKeyvalQuote(r rune) bool {
+	return r == ' ' || r == '"' || r == '=' || unicode.IsControl(r) || r == utf8.RuneError
+}
+
+// NewSlogLogger returns a Logger that writes to l, passing keyvals through
+// as slog attributes.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (s *slogLogger) Info(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (s *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (s *slogLogger) Error(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
+
+// withKeyvals returns a Logger that adds keyvals to every line logged
+// through logger.
+func withKeyvals(logger Logger, keyvals ...interface{}) Logger {
+	return &keyvalsLogger{logger, keyvals}
+}
+
+type keyvalsLogger struct {
+	logger  Logger
+	keyvals []interface{}
+}
+
+func (k *keyvalsLogger) Debug(msg string, keyvals ...interface{}) {
+	k.logger.Debug(msg, k.with(keyvals)...)
+}
+
+func (k *keyvalsLogger) Info(msg string, keyvals ...interface{}) {
+	k.logger.Info(msg, k.with(keyvals)...)
+}
+
+func (k *keyvalsLogger) Warn(msg string, keyvals ...interface{}) {
+	k.logger.Warn(msg, k.with(keyvals)...)
+}
+
+func (k *keyvalsLogger) Error(msg string, keyvals ...interface{}) {
+	k.logger.Error(msg, k.with(keyvals)...)
+}
+
+func (k *keyvalsLogger) with(keyvals []interface{}) []interface{} {
+	all := make([]interface{}, 0, len(k.keyvals)+len(keyvals))
+	all = append(all, k.keyvals...)
+	return append(all, keyvals...)
+}
+
+// loggerWriter is an io.Writer that logs each write at LevelInfo, so that a
+// *log.Logger can be backed by a Logger.
+type loggerWriter struct {
+	logger Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+func logAtLevel(logger Logger, level Level, msg string, keyvals ...interface{}) {
+	switch level {
+	case LevelDebug:
+		logger.Debug(msg, keyvals...)
+	case LevelWarn:
+		logger.Warn(msg, keyvals...)
+	case LevelError:
+		logger.Error(msg, keyvals...)
+	default:
+		logger.Info(msg, keyvals...)
+	}
+}
+
+// levelForStatus maps 5xx responses to LevelError, 4xx to LevelWarn and
+// everything else to LevelInfo.
+func levelForStatus(status int) Level {
+	switch {
+	case status >= 500:
+		return LevelError
+	case status >= 400:
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
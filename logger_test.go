@@ -0,0 +1,36 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestStdLoggerQuotesValues(t *testing.T) {
+	var out bytes.Buffer
+	NewStdLogger(log.New(&out, "", 0)).Info("msg", "plain", "GET", "spaced", "a b", "forged", "x\nFAKE status=200")
+	want := `INFO msg plain=GET spaced="a b" forged="x\nFAKE status=200"` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStructuredLoggerHeaderInjection(t *testing.T) {
+	var out bytes.Buffer
+	handler := WrapLoggingHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	}, WithLogger(NewStdLogger(log.New(&out, "", 0))), WithVerbose())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "x\nFAKE LINE status=200")
+	handler(context.Background(), httptest.NewRecorder(), req, nil)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "FAKE") {
+			t.Errorf("forged log line: %q", line)
+		}
+	}
+}
@@ -3,70 +3,494 @@ package appkit
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/jmcvetta/randutil"
 	"github.com/julienschmidt/httprouter"
-	"golang.org/x/net/context"
 )
 
-const contextLoggerKey = "reqLogger"
-
 func WrapLoggingHandler(handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapLoggingHandlerWithOptions(handler)
+}
+
+func WrapLoggingHandlerWithOptions(handler ContextHandlerFunc, options ...Option) ContextHandlerFunc {
+	opts := defaultOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	opts.setDefaults()
 	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
-		loggingW := wrapLoggingResponseWriter(w)
+		id := opts.requestID(req)
+		if !opts.DisableResponseIDHeader {
+			w.Header().Set(opts.ResponseIDHeader, id)
+		}
+		var logger *log.Logger
+		var leveledLogger Logger
+		if opts.Logger != nil {
+			leveledLogger = withKeyvals(opts.Logger, "request_id", id)
+			logger = log.New(loggerWriter{leveledLogger}, "", 0)
+		} else {
+			logger = newLoggerForId(opts.HandlerOut, id)
+			leveledLogger = NewStdLogger(logger)
+		}
+		t := opts.clock.Now()
+		reqErr := &requestError{}
+		ctx = contextRequestInfoKey.Set(ctx, &RequestInfo{
+			ID:            id,
+			StartTime:     t,
+			Logger:        logger,
+			leveledLogger: leveledLogger,
+			err:           reqErr,
+		})
+
+		loggingW := wrapLoggingResponseWriter(w, leveledLogger, opts.clock)
+
+		accessLogger := log.New(opts.AccessOut, "", 0)
 
-		logger := newLoggerForId(makeId())
-		ctx = context.WithValue(ctx, contextLoggerKey, logger)
+		skip := opts.shouldSkip(req)
+		sampled := opts.sampled()
+		entry := newLogEntry(ctx, opts, id, req, params)
 
-		t := time.Now()
-		writeStartLine(logger, req, t, params)
+		switch {
+		case skip, !sampled, opts.SingleLine, GetLogLevel() > LevelDebug:
+		case opts.Logger != nil:
+			writeStructuredStartLine(leveledLogger, entry, t)
+		case opts.LineFormatter != nil:
+			writeFormattedLine(accessLogger, opts.LineFormatter, entry.logLine(t, LevelDebug, true))
+		case opts.Format == FormatCommon, opts.Format == FormatCombined:
+		case opts.Format == FormatJSON:
+			writeJSONStartLine(accessLogger, entry, t)
+		case opts.Format == FormatConsole:
+			writeConsoleStartLine(accessLogger, entry, t)
+		default:
+			writeStartLine(accessLogger, entry, t)
+		}
+
+		if opts.DumpWhen != nil && GetLogLevel() <= LevelDebug && opts.DumpWhen(req) {
+			lines := dumpRequest(req, &opts, opts.DumpBody)
+			if opts.Logger != nil {
+				leveledLogger.Debug("Request dump", "dump", strings.Join(lines, "\n"))
+			} else {
+				for _, line := range lines {
+					leveledLogger.Debug(line)
+				}
+			}
+		}
 
 		handler(ctx, loggingW, req, params)
 
-		t2 := time.Now()
-		writeEndLine(logger, req, t2, loggingW.Status(), loggingW.Size(), t2.Sub(t))
+		t2 := opts.clock.Now()
+		if firstByte := loggingW.FirstByteTime(); !firstByte.IsZero() {
+			entry.ttfb = firstByte.Sub(t)
+			entry.hasTTFB = true
+		}
+		entry.flushes = loggingW.Flushes()
+		if err := reqErr.get(); err != nil {
+			entry.err = escapeControlChars(err.Error())
+		}
+		if entry.verbose {
+			entry.contentType = escapeControlChars(loggingW.Header().Get("Content-Type"))
+		}
+		switch {
+		case skip, !sampled && loggingW.Status() < 400, entry.endLevel(loggingW.Status(), t2.Sub(t)) < GetLogLevel():
+		case opts.Logger != nil:
+			writeStructuredEndLine(leveledLogger, entry, t2, loggingW.Status(), loggingW.Size(), t2.Sub(t))
+		case opts.LineFormatter != nil:
+			line := entry.logLine(t2, entry.endLevel(loggingW.Status(), t2.Sub(t)), false)
+			line.Status, line.Size, line.Duration = loggingW.Status(), loggingW.Size(), t2.Sub(t)
+			line.Error = entry.err
+			writeFormattedLine(accessLogger, opts.LineFormatter, line)
+		case opts.Format == FormatJSON:
+			writeJSONEndLine(accessLogger, entry, t2, loggingW.Status(), loggingW.Size(), t2.Sub(t))
+		case opts.Format == FormatConsole:
+			writeConsoleEndLine(accessLogger, entry, t2, loggingW.Status(), loggingW.Size(), t2.Sub(t))
+		case opts.Format == FormatCommon, opts.Format == FormatCombined:
+			writeNCSALine(accessLogger, entry, t, loggingW.Status(), loggingW.Size(), opts.Format == FormatCombined)
+		default:
+			writeEndLine(accessLogger, entry, t2, loggingW.Status(), loggingW.Size(), t2.Sub(t))
+		}
 	}
 }
 
+var defaultLogger atomic.Pointer[log.Logger]
+
+func init() {
+	defaultLogger.Store(log.New(defaultOptions.Out, "", 0))
+}
+
+// SetDefaultLogger sets the logger GetLoggerFromContext returns for contexts
+// that do not carry one. It defaults to a logger writing to os.Stdout, and
+// only SetDefaultLogger changes it: the Out of a logging handler applies to
+// the requests it wraps, not to code running outside of them.
+func SetDefaultLogger(logger *log.Logger) {
+	defaultLogger.Store(logger)
+}
+
+// GetLoggerFromContext returns the request logger in ctx, which writes to the
+// wrapping handler's Out, or the default logger set with SetDefaultLogger if
+// ctx does not carry one.
 func GetLoggerFromContext(ctx context.Context) *log.Logger {
-	if logger, ok := ctx.Value(contextLoggerKey).(*log.Logger); ok {
-		return logger
+	if info, ok := contextRequestInfoKey.Get(ctx); ok && info.Logger != nil {
+		return info.Logger
 	}
-	return log.New(os.Stdout, "", 0)
+	return defaultLogger.Load()
 }
 
-func newLoggerForId(id string) *log.Logger {
-	return log.New(os.Stdout, fmt.Sprintf("[%s] ", id), 0)
+// WithLoggerField returns a context whose logger adds key and value to every
+// line. With the default text logger they are appended to the line prefix;
+// with a structured Logger they become an attribute.
+func WithLoggerField(ctx context.Context, key string, value interface{}) context.Context {
+	var logger *log.Logger
+	leveledLogger := getLeveledLoggerFromContext(ctx)
+	if std, ok := leveledLogger.(*stdLogger); ok {
+		logger = log.New(std.l.Writer(), fmt.Sprintf("%s%s=%v ", std.l.Prefix(), key, value), std.l.Flags())
+		leveledLogger = NewStdLogger(logger)
+	} else {
+		leveledLogger = withKeyvals(leveledLogger, key, value)
+		logger = log.New(loggerWriter{leveledLogger}, "", 0)
+	}
+	return withLoggers(ctx, logger, leveledLogger)
+}
+
+// ContextWithLogger returns a context whose logger is logger, e.g. for capturing
+// the logs of a handler under test.
+func ContextWithLogger(ctx context.Context, logger *log.Logger) context.Context {
+	return withLoggers(ctx, logger, NewStdLogger(logger))
+}
+
+func withLoggers(ctx context.Context, logger *log.Logger, leveledLogger Logger) context.Context {
+	info := &RequestInfo{}
+	if parent, ok := contextRequestInfoKey.Get(ctx); ok {
+		*info = *parent
+	}
+	info.Logger = logger
+	info.leveledLogger = leveledLogger
+	return contextRequestInfoKey.Set(ctx, info)
+}
+
+// getLeveledLoggerFromContext returns the leveled counterpart of
+// GetLoggerFromContext.
+func getLeveledLoggerFromContext(ctx context.Context) Logger {
+	if info, ok := contextRequestInfoKey.Get(ctx); ok && info.leveledLogger != nil {
+		return info.leveledLogger
+	}
+	return NewStdLogger(GetLoggerFromContext(ctx))
 }
 
+// GetRequestIDFromContext returns the ID of the current request, or an empty
+// string if the context does not carry one.
+func GetRequestIDFromContext(ctx context.Context) string {
+	if info, ok := contextRequestInfoKey.Get(ctx); ok {
+		return info.ID
+	}
+	return ""
+}
+
+func newLoggerForId(out io.Writer, id string) *log.Logger {
+	return log.New(out, fmt.Sprintf("[%s] ", id), 0)
+}
+
+var (
+	randomAlphaString = randutil.AlphaString
+	fallbackIdCounter uint64
+)
+
 func makeId() string {
-	if r, err := randutil.AlphaString(8); err == nil {
-		return fmt.Sprintf("%s%x", r, time.Now().Unix())
-	} else {
-		panic(err)
+	r, err := randomAlphaString(8)
+	if err != nil {
+		// Random IDs are nice to have but not worth failing a request over, so
+		// fall back to a process-wide counter.
+		r = fmt.Sprintf("%08x", atomic.AddUint64(&fallbackIdCounter, 1))
+	}
+	return fmt.Sprintf("%s%x", r, time.Now().Unix())
+}
+
+// SequentialIDGenerator returns an ID generator yielding "req-1", "req-2" and
+// so on, for tests that compare log output. Each generator has its own
+// counter, which is safe for concurrent use.
+func SequentialIDGenerator() func() string {
+	var n uint64
+	return func() string {
+		return "req-" + strconv.FormatUint(atomic.AddUint64(&n, 1), 10)
+	}
+}
+
+// requestID returns the ID for req, preferring one supplied by the client.
+func (opts *Options) requestID(req *http.Request) string {
+	for _, extract := range opts.RequestIDExtractors {
+		if id := sanitizeRequestId(extract(req)); id != "" {
+			return id
+		}
 	}
+	if id := sanitizeRequestId(req.Header.Get(opts.RequestIDHeader)); id != "" {
+		return id
+	}
+	return opts.IDGenerator()
+}
+
+// sanitizeRequestId strips control characters from a client-supplied request
+// ID and caps its length, so that the ID cannot be used to forge log lines.
+func sanitizeRequestId(id string) string {
+	id = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, id)
+	id = strings.TrimSpace(id)
+	if len(id) > maxRequestIDLength {
+		id = id[:runeBoundary(id, maxRequestIDLength)]
+	}
+	return id
+}
+
+// truncateLogValue shortens s to at most max bytes, marking the cut with an
+// ellipsis. A max of zero means no limit.
+func truncateLogValue(s string, max int) string {
+	const ellipsis = "..."
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	if max <= len(ellipsis) {
+		return s[:runeBoundary(s, max)]
+	}
+	return s[:runeBoundary(s, max-len(ellipsis))] + ellipsis
+}
+
+// runeBoundary returns the largest index no greater than n that does not
+// split a UTF-8 sequence in s.
+func runeBoundary(s string, n int) int {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// logEntry holds the request details that go into the start and end lines.
+type logEntry struct {
+	id     string
+	method string
+	url    string
+	proto  string
+	user   string
+	path   string
+	// query is the redacted query string, logged separately from path in
+	// the JSON and structured formats.
+	query    string
+	route    string
+	handler  string
+	params   httprouter.Params
+	clientIP string
+	// fingerprint is set when Options.Fingerprint is.
+	fingerprint string
+	// country is set when Options.GeoResolver resolves the client IP.
+	country string
+
+	startVerb       string
+	endVerb         string
+	durationUnit    DurationUnit
+	timestampLayout string
+	slowThreshold   time.Duration
+	consoleColor    bool
+
+	ttfb    time.Duration
+	hasTTFB bool
+	flushes int
+
+	verbose bool
+	scheme  string
+	// tlsVersion and tlsCipher are empty for plaintext connections.
+	tlsVersion string
+	tlsCipher  string
+	userAgent  string
+	referer    string
+	headers    []loggedHeader
+	// contentLength is the request's Content-Length, or -1 if unknown.
+	contentLength int64
+	// contentType is the response's Content-Type, filled in once the
+	// handler returns.
+	contentType string
+	// err is the error recorded with SetRequestError, filled in once the
+	// handler returns.
+	err string
+}
+
+type loggedHeader struct {
+	name  string
+	value string
+}
+
+func newLogEntry(ctx context.Context, opts Options, id string, req *http.Request, params httprouter.Params) *logEntry {
+	// Everything that comes from the request is escaped so that crafted
+	// values cannot inject fake log lines.
+	entry := &logEntry{
+		id:       id,
+		method:   escapeControlChars(req.Method),
+		url:      truncateLogValue(escapeControlChars(redactURL(req.URL, opts.RedactQueryParams)), opts.MaxURLLength),
+		proto:    escapeControlChars(req.Proto),
+		path:     truncateLogValue(escapeControlChars(req.URL.Path), opts.MaxURLLength),
+		query:    truncateLogValue(escapeControlChars(redactQuery(req.URL.RawQuery, opts.RedactQueryParams)), opts.MaxURLLength),
+		route:    GetRoutePatternFromContext(ctx),
+		handler:  escapeControlChars(HandlerNameFromContext(ctx)),
+		clientIP: clientIP(req, opts.trustedProxyNets),
+
+		startVerb:     opts.StartVerb,
+		endVerb:       opts.EndVerb,
+		durationUnit:  opts.DurationUnit,
+		slowThreshold: opts.SlowThreshold,
+		consoleColor:  opts.consoleColor,
+	}
+	if len(params) > 0 {
+		entry.params = make(httprouter.Params, len(params))
+		for i, param := range params {
+			entry.params[i] = httprouter.Param{
+				Key:   escapeControlChars(param.Key),
+				Value: truncateLogValue(escapeControlChars(param.Value), opts.MaxParamValueLength),
+			}
+		}
+	}
+	if !opts.DisableTimestamp {
+		entry.timestampLayout = opts.TimestampLayout
+	}
+	if len(opts.Fingerprint) > 0 {
+		entry.fingerprint = fingerprint(req, opts.Fingerprint)
+	}
+	if opts.GeoResolver != nil {
+		if ip := net.ParseIP(entry.clientIP); ip != nil {
+			if country, ok := opts.GeoResolver(ip); ok {
+				entry.country = escapeControlChars(country)
+			}
+		}
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		entry.user = escapeControlChars(user)
+	}
+	if opts.Verbose || opts.Format == FormatCombined {
+		entry.userAgent = escapeControlChars(redactHeaderValue("User-Agent", req.UserAgent(), opts.RedactHeaders))
+		entry.referer = escapeControlChars(redactHeaderValue("Referer", req.Referer(), opts.RedactHeaders))
+	}
+	if opts.Verbose {
+		entry.verbose = true
+		entry.scheme = RequestScheme(req, opts.TrustProxyHeaders)
+		if req.TLS != nil {
+			entry.tlsVersion = strings.ReplaceAll(tls.VersionName(req.TLS.Version), " ", "")
+			entry.tlsCipher = tls.CipherSuiteName(req.TLS.CipherSuite)
+		}
+		entry.contentLength = req.ContentLength
+		for _, name := range opts.LogHeaders {
+			name = http.CanonicalHeaderKey(name)
+			values, ok := req.Header[name]
+			if !ok {
+				continue
+			}
+			entry.headers = append(entry.headers, loggedHeader{
+				name:  name,
+				value: escapeControlChars(redactHeaderValue(name, strings.Join(values, ", "), opts.RedactHeaders)),
+			})
+		}
+	}
+	return entry
+}
+
+func (entry *logEntry) isSlow(elapsedTime time.Duration) bool {
+	return entry.slowThreshold > 0 && elapsedTime > entry.slowThreshold
+}
+
+// endLevel is the level of the end line: by status class, but at least
+// LevelWarn for slow requests.
+func (entry *logEntry) endLevel(status int, elapsedTime time.Duration) Level {
+	level := levelForStatus(status)
+	if entry.isSlow(elapsedTime) && level < LevelWarn {
+		level = LevelWarn
+	}
+	return level
+}
+
+// writeTextLinePrefix writes the timestamp, request ID and level that start
+// every text line.
+func writeTextLinePrefix(buf *bytes.Buffer, entry *logEntry, timestamp time.Time, level Level) {
+	if entry.timestampLayout != "" {
+		buf.WriteString(timestamp.Format(entry.timestampLayout))
+		buf.WriteString(" ")
+	}
+	buf.WriteString("[")
+	buf.WriteString(entry.id)
+	buf.WriteString("] ")
+	buf.WriteString(level.String())
+	buf.WriteString(" ")
+}
+
+// quoteEscaped double-quotes s, which has already been through
+// escapeControlChars, escaping only its quotes so that nothing is escaped
+// twice.
+func quoteEscaped(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// escapeControlChars replaces control characters in s, such as CR and LF,
+// with Go escape sequences.
+func escapeControlChars(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) < 0 {
+		return s
+	}
+	buf := new(bytes.Buffer)
+	for _, r := range s {
+		if !unicode.IsControl(r) {
+			buf.WriteRune(r)
+			continue
+		}
+		quoted := strconv.QuoteRune(r)
+		buf.WriteString(quoted[1 : len(quoted)-1])
+	}
+	return buf.String()
 }
 
 func writeStartLine(
 	logger *log.Logger,
-	req *http.Request,
-	timestamp time.Time,
-	params httprouter.Params) {
+	entry *logEntry,
+	timestamp time.Time) {
 	buf := new(bytes.Buffer)
-	buf.WriteString("Handling ")
-	buf.WriteString(req.Method)
+	writeTextLinePrefix(buf, entry, timestamp, LevelDebug)
+	buf.WriteString(entry.startVerb)
+	buf.WriteString(" ")
+	buf.WriteString(entry.method)
 	buf.WriteString(" ")
-	buf.WriteString(req.URL.String())
+	buf.WriteString(entry.url)
+	if entry.route != "" {
+		buf.WriteString(" route=")
+		buf.WriteString(entry.route)
+	}
+	if entry.handler != "" {
+		buf.WriteString(" handler=")
+		buf.WriteString(entry.handler)
+	}
+	if entry.fingerprint != "" {
+		buf.WriteString(" fp=")
+		buf.WriteString(entry.fingerprint)
+	}
+	buf.WriteString(" from ")
+	buf.WriteString(entry.clientIP)
+	if entry.country != "" {
+		buf.WriteString(" country=")
+		buf.WriteString(entry.country)
+	}
 
-	if len(params) > 0 {
+	if len(entry.params) > 0 {
 		buf.WriteString(" ")
-		for i, param := range params {
+		for i, param := range entry.params {
 			if i > 0 {
 				buf.WriteString(" ")
 			}
@@ -81,13 +505,281 @@ func writeStartLine(
 
 func writeEndLine(
 	logger *log.Logger,
-	req *http.Request,
+	entry *logEntry,
+	timestamp time.Time,
+	status int,
+	size int64,
+	elapsedTime time.Duration) {
+	buf := new(bytes.Buffer)
+	writeTextLinePrefix(buf, entry, timestamp, entry.endLevel(status, elapsedTime))
+	fmt.Fprintf(buf, "%s %s %s", entry.endVerb, entry.method, entry.url)
+	if entry.route != "" {
+		fmt.Fprintf(buf, " route=%s", entry.route)
+	}
+	if entry.handler != "" {
+		fmt.Fprintf(buf, " handler=%s", entry.handler)
+	}
+	if entry.fingerprint != "" {
+		fmt.Fprintf(buf, " fp=%s", entry.fingerprint)
+	}
+	fmt.Fprintf(buf, " from %s (%d, %s, %d bytes)",
+		entry.clientIP, status, formatDuration(elapsedTime, entry.durationUnit), size)
+	if entry.country != "" {
+		fmt.Fprintf(buf, " country=%s", entry.country)
+	}
+	if entry.hasTTFB {
+		fmt.Fprintf(buf, " ttfb=%s", formatDuration(entry.ttfb, entry.durationUnit))
+	}
+	if entry.flushes > 0 {
+		fmt.Fprintf(buf, " flushes=%d", entry.flushes)
+	}
+	if entry.isSlow(elapsedTime) {
+		buf.WriteString(" SLOW")
+	}
+	if entry.err != "" {
+		fmt.Fprintf(buf, " error=%s", quoteEscaped(entry.err))
+	}
+	if entry.verbose {
+		// Header values are client-controlled and may contain spaces or
+		// quotes, so quote them to keep the line parseable.
+		fmt.Fprintf(buf, " scheme=%s user_agent=%s referer=%s", entry.scheme, quoteEscaped(entry.userAgent), quoteEscaped(entry.referer))
+		if entry.tlsVersion != "" {
+			fmt.Fprintf(buf, " tls_version=%s tls_cipher=%s", entry.tlsVersion, entry.tlsCipher)
+		}
+		if entry.contentLength >= 0 {
+			fmt.Fprintf(buf, " content_length=%d", entry.contentLength)
+		}
+		if entry.contentType != "" {
+			fmt.Fprintf(buf, " content_type=%s", quoteEscaped(entry.contentType))
+		}
+		for _, h := range entry.headers {
+			fmt.Fprintf(buf, " %s=%s", h.name, quoteEscaped(h.value))
+		}
+	}
+	logger.Print(buf.String())
+}
+
+func formatDuration(d time.Duration, unit DurationUnit) string {
+	switch unit {
+	case DurationMillis:
+		return fmt.Sprintf("%dms", int(d/time.Millisecond))
+	case DurationMicros:
+		return fmt.Sprintf("%dus", int64(d/time.Microsecond))
+	default:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	}
+}
+
+type jsonRequestFields struct {
+	Time        string            `json:"time,omitempty"`
+	Level       string            `json:"level"`
+	Message     string            `json:"msg"`
+	RequestID   string            `json:"request_id"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Query       string            `json:"query,omitempty"`
+	Route       string            `json:"route"`
+	Handler     string            `json:"handler,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+	ClientIP    string            `json:"client_ip"`
+	Fingerprint string            `json:"fp,omitempty"`
+	Country     string            `json:"country,omitempty"`
+}
+
+type jsonStartLine struct {
+	jsonRequestFields
+}
+
+type jsonEndLine struct {
+	jsonRequestFields
+	Status        int               `json:"status"`
+	Bytes         int64             `json:"bytes"`
+	DurationMs    float64           `json:"duration_ms"`
+	DurationNs    int64             `json:"duration_ns"`
+	TTFBMs        *float64          `json:"ttfb_ms,omitempty"`
+	Flushes       int               `json:"flushes,omitempty"`
+	Slow          bool              `json:"slow,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Scheme        string            `json:"scheme,omitempty"`
+	TLSVersion    string            `json:"tls_version,omitempty"`
+	TLSCipher     string            `json:"tls_cipher,omitempty"`
+	UserAgent     string            `json:"user_agent,omitempty"`
+	Referer       string            `json:"referer,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	ContentLength *int64            `json:"content_length,omitempty"`
+	ContentType   string            `json:"content_type,omitempty"`
+}
+
+func newJSONRequestFields(timestamp time.Time, level Level, message string, entry *logEntry, withParams bool) jsonRequestFields {
+	fields := jsonRequestFields{
+		Level:       level.String(),
+		Message:     message,
+		RequestID:   entry.id,
+		Method:      entry.method,
+		Path:        entry.path,
+		Query:       entry.query,
+		Route:       entry.route,
+		Handler:     entry.handler,
+		ClientIP:    entry.clientIP,
+		Fingerprint: entry.fingerprint,
+		Country:     entry.country,
+	}
+	if entry.timestampLayout != "" {
+		fields.Time = timestamp.Format(entry.timestampLayout)
+	}
+	if fields.Route == "" {
+		fields.Route = entry.path
+	}
+	if withParams && len(entry.params) > 0 {
+		fields.Params = make(map[string]string, len(entry.params))
+		for _, param := range entry.params {
+			fields.Params[param.Key] = param.Value
+		}
+	}
+	return fields
+}
+
+func writeJSONStartLine(
+	logger *log.Logger,
+	entry *logEntry,
+	timestamp time.Time) {
+	writeJSONLine(logger, jsonStartLine{
+		jsonRequestFields: newJSONRequestFields(timestamp, LevelDebug, entry.startVerb, entry, true),
+	})
+}
+
+func writeJSONEndLine(
+	logger *log.Logger,
+	entry *logEntry,
 	timestamp time.Time,
 	status int,
-	size int,
+	size int64,
 	elapsedTime time.Duration) {
-	logger.Printf("Completed %s %s (%d, %dms, %d bytes)", req.Method, req.URL.String(),
-		status, int(elapsedTime/time.Millisecond), size)
+	line := jsonEndLine{
+		jsonRequestFields: newJSONRequestFields(timestamp, entry.endLevel(status, elapsedTime), entry.endVerb, entry, false),
+		Status:            status,
+		Bytes:             size,
+		DurationMs:        float64(elapsedTime) / float64(time.Millisecond),
+		DurationNs:        int64(elapsedTime),
+		Flushes:           entry.flushes,
+		Slow:              entry.isSlow(elapsedTime),
+		Error:             entry.err,
+		Scheme:            entry.scheme,
+		TLSVersion:        entry.tlsVersion,
+		TLSCipher:         entry.tlsCipher,
+		UserAgent:         entry.userAgent,
+		Referer:           entry.referer,
+		ContentType:       entry.contentType,
+	}
+	if entry.verbose && entry.contentLength >= 0 {
+		contentLength := entry.contentLength
+		line.ContentLength = &contentLength
+	}
+	if entry.hasTTFB {
+		ttfbMs := float64(entry.ttfb) / float64(time.Millisecond)
+		line.TTFBMs = &ttfbMs
+	}
+	if len(entry.headers) > 0 {
+		line.Headers = make(map[string]string, len(entry.headers))
+		for _, h := range entry.headers {
+			line.Headers[h.name] = h.value
+		}
+	}
+	writeJSONLine(logger, line)
+}
+
+func writeJSONLine(logger *log.Logger, line interface{}) {
+	b, err := json.Marshal(line)
+	if err != nil {
+		logger.Printf("Failed to encode log line: %s", err)
+		return
+	}
+	logger.Print(string(b))
+}
+
+// keyvals returns the request fields common to the start and end lines, for
+// structured loggers.
+func (entry *logEntry) keyvals() []interface{} {
+	route := entry.route
+	if route == "" {
+		route = entry.path
+	}
+	keyvals := []interface{}{
+		"method", entry.method,
+		"path", entry.path,
+		"route", route,
+		"client_ip", entry.clientIP,
+	}
+	if entry.query != "" {
+		keyvals = append(keyvals, "query", entry.query)
+	}
+	if entry.handler != "" {
+		keyvals = append(keyvals, "handler", entry.handler)
+	}
+	if entry.fingerprint != "" {
+		keyvals = append(keyvals, "fp", entry.fingerprint)
+	}
+	if entry.country != "" {
+		keyvals = append(keyvals, "country", entry.country)
+	}
+	return keyvals
+}
+
+func writeStructuredStartLine(
+	logger Logger,
+	entry *logEntry,
+	timestamp time.Time) {
+	keyvals := entry.keyvals()
+	if len(entry.params) > 0 {
+		params := make(map[string]string, len(entry.params))
+		for _, param := range entry.params {
+			params[param.Key] = param.Value
+		}
+		keyvals = append(keyvals, "params", params)
+	}
+	logger.Debug(entry.startVerb, keyvals...)
+}
+
+func writeStructuredEndLine(
+	logger Logger,
+	entry *logEntry,
+	timestamp time.Time,
+	status int,
+	size int64,
+	elapsedTime time.Duration) {
+	keyvals := append(entry.keyvals(),
+		"status", status,
+		"bytes", size,
+		"duration", elapsedTime,
+	)
+	if entry.hasTTFB {
+		keyvals = append(keyvals, "ttfb", entry.ttfb)
+	}
+	if entry.flushes > 0 {
+		keyvals = append(keyvals, "flushes", entry.flushes)
+	}
+	if entry.isSlow(elapsedTime) {
+		keyvals = append(keyvals, "slow", true)
+	}
+	if entry.err != "" {
+		keyvals = append(keyvals, "error", entry.err)
+	}
+	if entry.verbose {
+		keyvals = append(keyvals, "scheme", entry.scheme, "user_agent", entry.userAgent, "referer", entry.referer)
+		if entry.tlsVersion != "" {
+			keyvals = append(keyvals, "tls_version", entry.tlsVersion, "tls_cipher", entry.tlsCipher)
+		}
+		if entry.contentLength >= 0 {
+			keyvals = append(keyvals, "content_length", entry.contentLength)
+		}
+		if entry.contentType != "" {
+			keyvals = append(keyvals, "content_type", entry.contentType)
+		}
+		for _, h := range entry.headers {
+			keyvals = append(keyvals, h.name, h.value)
+		}
+	}
+	logAtLevel(logger, entry.endLevel(status, elapsedTime), entry.endVerb, keyvals...)
 }
 
 // The following derived from https://github.com/gorilla/handlers/blob/master/handlers.go
@@ -96,30 +788,88 @@ func writeEndLine(
 type loggingResponseWriter interface {
 	http.ResponseWriter
 	http.Flusher
+	io.ReaderFrom
 	Status() int
-	Size() int
+	Size() int64
+	WroteHeader() bool
+	FirstByteTime() time.Time
+	// Flushes returns the number of times the response has been flushed.
+	Flushes() int
+	// HeaderSnapshot returns a copy of the headers as they were sent, or nil
+	// if they have not been.
+	HeaderSnapshot() http.Header
+	// Unwrap returns the underlying writer, for http.ResponseController.
+	Unwrap() http.ResponseWriter
+	// onWriteHeader registers fn to run just before the headers are sent,
+	// with the status being sent. fn may change the headers but must not
+	// write to the response.
+	onWriteHeader(fn func(status int))
+	// rollback discards the response written so far, if it is buffered and
+	// has not been sent, and reports whether it did.
+	rollback() bool
+}
+
+// ensureLoggingResponseWriter returns w itself if it already tracks status
+// and size, and wraps it otherwise.
+func ensureLoggingResponseWriter(w http.ResponseWriter, logger Logger) loggingResponseWriter {
+	if loggingW, ok := w.(loggingResponseWriter); ok {
+		return loggingW
+	}
+	return wrapLoggingResponseWriter(w, logger, realClock{})
 }
 
-func wrapLoggingResponseWriter(w http.ResponseWriter) loggingResponseWriter {
-	var logger loggingResponseWriter = &responseLogger{w: w}
+// ResponseStatus returns the status written to w so far, or 0 if none has
+// been, and whether w tracks it, as the writers passed to handlers inside
+// WrapLoggingHandler do. It lets middleware outside the package observe the
+// status without wrapping w again.
+func ResponseStatus(w http.ResponseWriter) (int, bool) {
+	if loggingW, ok := w.(loggingResponseWriter); ok {
+		return loggingW.Status(), true
+	}
+	return 0, false
+}
+
+// wrapLoggingResponseWriter wraps w to track the status and size of the
+// response. Misuse of the writer, such as calling WriteHeader twice, is
+// reported to logger.
+func wrapLoggingResponseWriter(w http.ResponseWriter, logger Logger, clk clock) loggingResponseWriter {
+	base := responseLogger{w: w, logger: logger, clock: clk}
+	var loggingW loggingResponseWriter = &base
 	if _, ok := w.(http.Hijacker); ok {
-		logger = &hijackLogger{responseLogger{w: w}}
+		loggingW = &hijackLogger{base}
 	}
-	h, ok1 := logger.(http.Hijacker)
+	h, ok1 := loggingW.(http.Hijacker)
 	c, ok2 := w.(http.CloseNotifier)
-	if ok1 && ok2 {
-		return hijackCloseNotifier{logger, h, c}
-	}
-	if ok2 {
-		return &closeNotifyWriter{logger, c}
+	p, ok3 := w.(http.Pusher)
+	switch {
+	case ok1 && ok2 && ok3:
+		return hijackCloseNotifyPusher{loggingW, h, c, p}
+	case ok1 && ok2:
+		return hijackCloseNotifier{loggingW, h, c}
+	case ok1 && ok3:
+		return hijackPusher{loggingW, h, p}
+	case ok2 && ok3:
+		return closeNotifyPusher{loggingW, c, p}
+	case ok2:
+		return &closeNotifyWriter{loggingW, c}
+	case ok3:
+		return pushLogger{loggingW, p}
 	}
-	return logger
+	return loggingW
 }
 
 type responseLogger struct {
-	w      http.ResponseWriter
-	status int
-	size   int
+	w           http.ResponseWriter
+	logger      Logger
+	clock       clock
+	status      int
+	size        int64
+	wroteHeader bool
+	firstByte   time.Time
+	flushes     int
+	hijacked    bool
+	headerHooks []func(status int)
+	sentHeader  http.Header
 }
 
 func (l *responseLogger) Header() http.Header {
@@ -127,35 +877,126 @@ func (l *responseLogger) Header() http.Header {
 }
 
 func (l *responseLogger) Write(b []byte) (int, error) {
+	if l.hijacked {
+		l.logger.Warn(fmt.Sprintf("Write of %d bytes after the connection was hijacked", len(b)))
+		return 0, http.ErrHijacked
+	}
 	if l.status == 0 {
 		// The status will be StatusOK if WriteHeader has not been called yet
 		l.status = http.StatusOK
 	}
+	l.markWroteHeader()
 	size, err := l.w.Write(b)
-	l.size += size
+	l.size += int64(size)
 	return size, err
 }
 
+// ReadFrom lets net/http send files with sendfile when the underlying writer
+// supports it, as it would without the wrapper.
+func (l *responseLogger) ReadFrom(r io.Reader) (int64, error) {
+	if l.hijacked {
+		l.logger.Warn("ReadFrom after the connection was hijacked")
+		return 0, http.ErrHijacked
+	}
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	l.markWroteHeader()
+	var n int64
+	var err error
+	if rf, ok := l.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(l.w, r)
+	}
+	l.size += n
+	return n, err
+}
+
 func (l *responseLogger) WriteHeader(s int) {
-	l.w.WriteHeader(s)
+	if l.hijacked {
+		l.logger.Warn(fmt.Sprintf("WriteHeader(%d) call after the connection was hijacked", s))
+		return
+	}
+	if l.wroteHeader {
+		l.logger.Warn(fmt.Sprintf("Superfluous WriteHeader(%d) call, already wrote %d", s, l.status))
+		return
+	}
+	if s >= 100 && s < 200 && s != http.StatusSwitchingProtocols {
+		// Informational responses, such as 103 Early Hints, precede the
+		// final one, which is still to come.
+		l.w.WriteHeader(s)
+		return
+	}
 	l.status = s
+	l.markWroteHeader()
+	l.w.WriteHeader(s)
+}
+
+// markWroteHeader must be called before the headers are sent to l.w.
+func (l *responseLogger) markWroteHeader() {
+	if l.wroteHeader {
+		return
+	}
+	for _, fn := range l.headerHooks {
+		fn(l.status)
+	}
+	l.sentHeader = l.w.Header().Clone()
+	l.wroteHeader = true
+	l.firstByte = l.clock.Now()
+}
+
+func (l *responseLogger) onWriteHeader(fn func(status int)) {
+	l.headerHooks = append(l.headerHooks, fn)
+}
+
+func (l *responseLogger) rollback() bool {
+	return false
+}
+
+func (l *responseLogger) WroteHeader() bool {
+	return l.wroteHeader
+}
+
+// FirstByteTime returns when the headers were first written, or the zero
+// time if they have not been.
+func (l *responseLogger) FirstByteTime() time.Time {
+	return l.firstByte
 }
 
 func (l *responseLogger) Status() int {
 	return l.status
 }
 
-func (l *responseLogger) Size() int {
+func (l *responseLogger) Size() int64 {
 	return l.size
 }
 
 func (l *responseLogger) Flush() {
 	f, ok := l.w.(http.Flusher)
 	if ok {
+		if l.status == 0 {
+			// Flushing commits the headers, so the status is StatusOK as with Write
+			l.status = http.StatusOK
+		}
+		l.markWroteHeader()
 		f.Flush()
+		l.flushes++
 	}
 }
 
+func (l *responseLogger) Unwrap() http.ResponseWriter {
+	return l.w
+}
+
+func (l *responseLogger) HeaderSnapshot() http.Header {
+	return l.sentHeader
+}
+
+func (l *responseLogger) Flushes() int {
+	return l.flushes
+}
+
 type hijackLogger struct {
 	responseLogger
 }
@@ -163,6 +1004,9 @@ type hijackLogger struct {
 func (l *hijackLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	h := l.responseLogger.w.(http.Hijacker)
 	conn, rw, err := h.Hijack()
+	if err == nil {
+		l.responseLogger.hijacked = true
+	}
 	if err == nil && l.responseLogger.status == 0 {
 		// The status will be StatusSwitchingProtocols if there was no error and WriteHeader has not been called yet
 		l.responseLogger.status = http.StatusSwitchingProtocols
@@ -180,3 +1024,27 @@ type hijackCloseNotifier struct {
 	http.Hijacker
 	http.CloseNotifier
 }
+
+type pushLogger struct {
+	loggingResponseWriter
+	http.Pusher
+}
+
+type hijackPusher struct {
+	loggingResponseWriter
+	http.Hijacker
+	http.Pusher
+}
+
+type closeNotifyPusher struct {
+	loggingResponseWriter
+	http.CloseNotifier
+	http.Pusher
+}
+
+type hijackCloseNotifyPusher struct {
+	loggingResponseWriter
+	http.Hijacker
+	http.CloseNotifier
+	http.Pusher
+}
@@ -0,0 +1,429 @@
+package appkit
+
+import (
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRequestIDHeader = "X-Request-ID"
+	maxRequestIDLength     = 128
+
+	// DefaultTimestampLayout is RFC3339 with millisecond precision.
+	DefaultTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// LogFormat selects how the start and end lines of a request are written.
+type LogFormat int
+
+const (
+	// FormatText writes free-form "Handling ..." and "Completed ..." lines.
+	FormatText LogFormat = iota
+	// FormatJSON writes one JSON object per line.
+	FormatJSON
+	// FormatCommon writes a single NCSA Common Log Format line per request.
+	FormatCommon
+	// FormatCombined writes a single NCSA Combined Log Format line per
+	// request, which adds the Referer and User-Agent to FormatCommon.
+	FormatCombined
+	// FormatConsole writes compact lines with aligned columns, colored by
+	// status when the output is a terminal, for local development.
+	FormatConsole
+)
+
+// DurationUnit selects how the elapsed time is written in text lines.
+type DurationUnit int
+
+const (
+	// DurationFractionalMillis writes milliseconds with two decimals, e.g.
+	// "0.42ms".
+	DurationFractionalMillis DurationUnit = iota
+	// DurationMillis writes whole milliseconds, e.g. "0ms".
+	DurationMillis
+	// DurationMicros writes whole microseconds, e.g. "420us".
+	DurationMicros
+)
+
+// Options configures the logging middleware.
+type Options struct {
+	// Out is where log lines are written. Defaults to os.Stdout. It does not
+	// affect the logger GetLoggerFromContext returns outside a wrapped
+	// handler; see SetDefaultLogger.
+	Out io.Writer
+	// AccessOut, if set, is where the start and end lines are written
+	// instead of Out.
+	AccessOut io.Writer
+	// HandlerOut, if set, is where the logger from GetLoggerFromContext
+	// writes instead of Out.
+	HandlerOut io.Writer
+	// Format of the start and end lines. Defaults to FormatText.
+	Format LogFormat
+	// Logger, if set, receives the start and end lines as structured
+	// key/value pairs, and Out and Format are ignored. See NewSlogLogger.
+	Logger Logger
+	// LineFormatter, if set, writes the start and end lines instead of
+	// Format. It is ignored if Logger is set.
+	LineFormatter LineFormatter
+	// StartVerb and EndVerb are the words that begin the start and end
+	// lines, and their messages in the JSON and structured formats.
+	// Default to "Handling" and "Completed".
+	StartVerb string
+	EndVerb   string
+	// IDGenerator returns the ID assigned to each request. Defaults to makeId.
+	IDGenerator func() string
+	// RequestIDExtractors are tried in order to take the request ID from a
+	// platform's tracing header, e.g. CloudTraceID or XRayTraceID, before
+	// falling back to RequestIDHeader and then IDGenerator.
+	RequestIDExtractors []RequestIDExtractor
+	// RequestIDHeader is the inbound header whose value, when present, is used
+	// as the request ID instead of generating one. Defaults to X-Request-ID.
+	RequestIDHeader string
+	// ResponseIDHeader is the response header the request ID is echoed in.
+	// Defaults to X-Request-ID.
+	ResponseIDHeader string
+	// DisableResponseIDHeader suppresses echoing the request ID.
+	DisableResponseIDHeader bool
+	// Skip, when it returns true, suppresses the start and end lines for a
+	// request. The handler still runs as usual.
+	Skip func(req *http.Request) bool
+	// SkipPaths lists request paths whose start and end lines are suppressed.
+	SkipPaths []string
+	// SkipPathPrefixes lists path prefixes whose start and end lines are
+	// suppressed.
+	SkipPathPrefixes []string
+	// SingleLine suppresses the start line so that each request is logged
+	// once, on completion.
+	SingleLine bool
+	// TrustProxyHeaders makes the logged client IP come from X-Forwarded-For
+	// or X-Real-IP when the request comes from one of TrustedProxies, and
+	// the scheme from X-Forwarded-Proto. Only enable it when running behind
+	// a trusted proxy.
+	TrustProxyHeaders bool
+	// TrustedProxies lists the IP addresses or CIDR ranges of the proxies in
+	// front of the server, whose X-Forwarded-For hops are skipped to find
+	// the client. Defaults to DefaultTrustedProxies.
+	TrustedProxies []string
+	// Verbose adds the scheme, the TLS version and cipher suite, the
+	// User-Agent and Referer request headers, and any headers listed in
+	// LogHeaders to the end line. The scheme honours
+	// X-Forwarded-Proto if TrustProxyHeaders is set.
+	Verbose bool
+	// LogHeaders lists additional request headers to log when Verbose is set.
+	LogHeaders []string
+	// RedactHeaders lists headers, matched case-insensitively, whose values
+	// are logged as [REDACTED]. Defaults to DefaultRedactHeaders; set it to an
+	// empty slice to log all headers verbatim.
+	RedactHeaders []string
+	// RedactQueryParams lists query parameters whose values are replaced by
+	// [REDACTED] in the logged URL.
+	RedactQueryParams []string
+	// MaxURLLength, if non-zero, truncates logged URLs, and the separate
+	// path and query of the JSON and structured formats, to that many bytes.
+	// Truncation happens after redaction.
+	MaxURLLength int
+	// MaxParamValueLength, if non-zero, truncates logged route param values
+	// to that many bytes.
+	MaxParamValueLength int
+	// DurationUnit of the elapsed time in text lines. Defaults to
+	// DurationFractionalMillis.
+	DurationUnit DurationUnit
+	// TimestampLayout is the time.Format layout of the timestamp that starts
+	// each line. Defaults to DefaultTimestampLayout.
+	TimestampLayout string
+	// DisableTimestamp omits the timestamp from each line.
+	DisableTimestamp bool
+	// SlowThreshold, if non-zero, makes requests that take longer than it
+	// log their end line at LevelWarn, tagged as slow.
+	SlowThreshold time.Duration
+	// Fingerprint, if set, adds fp=<hash> to the start and end lines, a
+	// short hash of the listed request attributes for grouping retries of
+	// the same request. An attribute is "method", "path", "query" or the name
+	// of a request header; see DefaultFingerprint.
+	Fingerprint []string
+	// GeoResolver, if set, maps the client IP to a country, which is added
+	// to the start and end lines. It runs on every request before the
+	// handler, so should answer from memory, e.g. from a MaxMind database.
+	GeoResolver func(ip net.IP) (country string, ok bool)
+	// DumpWhen, if set, selects requests whose method, URL and headers are
+	// logged in full at LevelDebug before the handler runs, with the usual
+	// redaction applied.
+	DumpWhen func(req *http.Request) bool
+	// DumpBody adds up to the first 64KB of the request body to dumps. The
+	// handler still sees the whole body.
+	DumpBody bool
+
+	// SampleRate, if between 0 and 1, is the fraction of successful requests
+	// that are logged, chosen at random once per request so that a sampled
+	// request gets both its lines. Requests that end in a 4xx or 5xx are
+	// always logged, but as the start line is written before the status is
+	// known, an unsampled one only gets its end line. Zero, the default, logs
+	// every request.
+	SampleRate float64
+	// DisableColor turns off the colors of FormatConsole. Colors are also
+	// off when the output is not a terminal or NO_COLOR is set.
+	DisableColor bool
+
+	// clock is overridden by tests. Defaults to realClock.
+	clock clock
+	// consoleColor is set by setDefaults when FormatConsole lines should be
+	// colored.
+	consoleColor bool
+	// trustedProxyNets is set by setDefaults from TrustedProxies.
+	trustedProxyNets []*net.IPNet
+}
+
+// sampled decides whether a request is logged under SampleRate.
+func (opts *Options) sampled() bool {
+	if opts.SampleRate <= 0 || opts.SampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < opts.SampleRate
+}
+
+func (opts Options) shouldSkip(req *http.Request) bool {
+	if opts.Skip != nil && opts.Skip(req) {
+		return true
+	}
+	path := req.URL.Path
+	for _, p := range opts.SkipPaths {
+		if path == p {
+			return true
+		}
+	}
+	for _, p := range opts.SkipPathPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultOptions = Options{Out: os.Stdout}
+
+const (
+	defaultStartVerb = "Handling"
+	defaultEndVerb   = "Completed"
+)
+
+func (opts *Options) setDefaults() {
+	if opts.Out == nil {
+		opts.Out = defaultOptions.Out
+	}
+	if opts.AccessOut == nil {
+		opts.AccessOut = opts.Out
+	}
+	if opts.HandlerOut == nil {
+		opts.HandlerOut = opts.Out
+	}
+	if opts.IDGenerator == nil {
+		opts.IDGenerator = makeId
+	}
+	if opts.clock == nil {
+		opts.clock = realClock{}
+	}
+	if opts.StartVerb == "" {
+		opts.StartVerb = defaultStartVerb
+	}
+	if opts.EndVerb == "" {
+		opts.EndVerb = defaultEndVerb
+	}
+	if opts.TimestampLayout == "" {
+		opts.TimestampLayout = DefaultTimestampLayout
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+	if opts.RequestIDHeader == "" {
+		opts.RequestIDHeader = defaultRequestIDHeader
+	}
+	if opts.ResponseIDHeader == "" {
+		opts.ResponseIDHeader = defaultRequestIDHeader
+	}
+	opts.trustedProxyNets = trustedProxyNets(opts.TrustProxyHeaders, opts.TrustedProxies)
+	opts.consoleColor = opts.Format == FormatConsole && useConsoleColor(opts.AccessOut, opts.DisableColor)
+}
+
+// Option configures the logging middleware; see WrapLoggingHandlerWithOptions.
+type Option func(*Options)
+
+// WithOutput sets Options.Out.
+func WithOutput(out io.Writer) Option {
+	return func(opts *Options) { opts.Out = out }
+}
+
+// WithAccessOutput sets Options.AccessOut.
+func WithAccessOutput(out io.Writer) Option {
+	return func(opts *Options) { opts.AccessOut = out }
+}
+
+// WithHandlerOutput sets Options.HandlerOut.
+func WithHandlerOutput(out io.Writer) Option {
+	return func(opts *Options) { opts.HandlerOut = out }
+}
+
+// WithFormat sets Options.Format.
+func WithFormat(format LogFormat) Option {
+	return func(opts *Options) { opts.Format = format }
+}
+
+// WithLineFormatter sets Options.LineFormatter.
+func WithLineFormatter(formatter LineFormatter) Option {
+	return func(opts *Options) { opts.LineFormatter = formatter }
+}
+
+// WithVerbs sets Options.StartVerb and Options.EndVerb.
+func WithVerbs(start, end string) Option {
+	return func(opts *Options) { opts.StartVerb, opts.EndVerb = start, end }
+}
+
+// WithLogger sets Options.Logger.
+func WithLogger(logger Logger) Option {
+	return func(opts *Options) { opts.Logger = logger }
+}
+
+// WithIDGenerator sets Options.IDGenerator.
+func WithIDGenerator(generator func() string) Option {
+	return func(opts *Options) { opts.IDGenerator = generator }
+}
+
+// WithRequestIDExtractors adds to Options.RequestIDExtractors.
+func WithRequestIDExtractors(extractors ...RequestIDExtractor) Option {
+	return func(opts *Options) {
+		opts.RequestIDExtractors = append(opts.RequestIDExtractors, extractors...)
+	}
+}
+
+// WithRequestIDHeader sets Options.RequestIDHeader.
+func WithRequestIDHeader(header string) Option {
+	return func(opts *Options) { opts.RequestIDHeader = header }
+}
+
+// WithResponseIDHeader sets Options.ResponseIDHeader.
+func WithResponseIDHeader(header string) Option {
+	return func(opts *Options) { opts.ResponseIDHeader = header }
+}
+
+// WithoutResponseIDHeader sets Options.DisableResponseIDHeader.
+func WithoutResponseIDHeader() Option {
+	return func(opts *Options) { opts.DisableResponseIDHeader = true }
+}
+
+// WithSkip sets Options.Skip.
+func WithSkip(skip func(req *http.Request) bool) Option {
+	return func(opts *Options) { opts.Skip = skip }
+}
+
+// WithSkipPaths adds to Options.SkipPaths.
+func WithSkipPaths(paths ...string) Option {
+	return func(opts *Options) { opts.SkipPaths = append(opts.SkipPaths, paths...) }
+}
+
+// WithSkipPathPrefixes adds to Options.SkipPathPrefixes.
+func WithSkipPathPrefixes(prefixes ...string) Option {
+	return func(opts *Options) { opts.SkipPathPrefixes = append(opts.SkipPathPrefixes, prefixes...) }
+}
+
+// WithSingleLine sets Options.SingleLine.
+func WithSingleLine() Option {
+	return func(opts *Options) { opts.SingleLine = true }
+}
+
+// WithTrustProxyHeaders sets Options.TrustProxyHeaders.
+func WithTrustProxyHeaders() Option {
+	return func(opts *Options) { opts.TrustProxyHeaders = true }
+}
+
+// WithTrustedProxies sets Options.TrustedProxies.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(opts *Options) { opts.TrustedProxies = proxies }
+}
+
+// WithVerbose sets Options.Verbose.
+func WithVerbose() Option {
+	return func(opts *Options) { opts.Verbose = true }
+}
+
+// WithLogHeaders adds to Options.LogHeaders.
+func WithLogHeaders(headers ...string) Option {
+	return func(opts *Options) { opts.LogHeaders = append(opts.LogHeaders, headers...) }
+}
+
+// WithRedactHeaders sets Options.RedactHeaders, replacing the defaults.
+func WithRedactHeaders(headers ...string) Option {
+	return func(opts *Options) { opts.RedactHeaders = append([]string{}, headers...) }
+}
+
+// WithRedactQueryParams adds to Options.RedactQueryParams.
+func WithRedactQueryParams(params ...string) Option {
+	return func(opts *Options) { opts.RedactQueryParams = append(opts.RedactQueryParams, params...) }
+}
+
+// WithMaxURLLength sets Options.MaxURLLength.
+func WithMaxURLLength(max int) Option {
+	return func(opts *Options) { opts.MaxURLLength = max }
+}
+
+// WithMaxParamValueLength sets Options.MaxParamValueLength.
+func WithMaxParamValueLength(max int) Option {
+	return func(opts *Options) { opts.MaxParamValueLength = max }
+}
+
+// WithDurationUnit sets Options.DurationUnit.
+func WithDurationUnit(unit DurationUnit) Option {
+	return func(opts *Options) { opts.DurationUnit = unit }
+}
+
+// WithTimestampLayout sets Options.TimestampLayout.
+func WithTimestampLayout(layout string) Option {
+	return func(opts *Options) { opts.TimestampLayout = layout }
+}
+
+// WithoutTimestamp sets Options.DisableTimestamp.
+func WithoutTimestamp() Option {
+	return func(opts *Options) { opts.DisableTimestamp = true }
+}
+
+// WithSlowThreshold sets Options.SlowThreshold.
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(opts *Options) { opts.SlowThreshold = threshold }
+}
+
+// WithFingerprint sets Options.Fingerprint.
+func WithFingerprint(attrs ...string) Option {
+	return func(opts *Options) { opts.Fingerprint = attrs }
+}
+
+// WithGeoResolver sets Options.GeoResolver.
+func WithGeoResolver(resolver func(ip net.IP) (country string, ok bool)) Option {
+	return func(opts *Options) { opts.GeoResolver = resolver }
+}
+
+// WithDumpWhen sets Options.DumpWhen.
+func WithDumpWhen(fn func(req *http.Request) bool) Option {
+	return func(opts *Options) { opts.DumpWhen = fn }
+}
+
+// WithDumpBody sets Options.DumpBody.
+func WithDumpBody() Option {
+	return func(opts *Options) { opts.DumpBody = true }
+}
+
+// WithSampleRate sets Options.SampleRate.
+func WithSampleRate(rate float64) Option {
+	return func(opts *Options) { opts.SampleRate = rate }
+}
+
+// WithoutColor sets Options.DisableColor.
+func WithoutColor() Option {
+	return func(opts *Options) { opts.DisableColor = true }
+}
+
+// withClock sets the clock used for timing, for tests.
+func withClock(c clock) Option {
+	return func(opts *Options) { opts.clock = c }
+}
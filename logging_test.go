@@ -0,0 +1,389 @@
+package appkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// fakeClock starts at a fixed time and advances by step on every reading.
+type fakeClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// serveLogged runs handler for req under the logging middleware and returns
+// everything it logged, one entry per line.
+func serveLogged(w http.ResponseWriter, req *http.Request, handler ContextHandlerFunc, options ...Option) []string {
+	var out bytes.Buffer
+	options = append([]Option{
+		WithOutput(&out),
+		WithIDGenerator(SequentialIDGenerator()),
+		withClock(&fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), step: 5 * time.Millisecond}),
+	}, options...)
+	WrapLoggingHandlerWithOptions(handler, options...)(context.Background(), w, req, nil)
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestMakeIdFallsBackWhenRandomFails(t *testing.T) {
+	saved := randomAlphaString
+	defer func() { randomAlphaString = saved }()
+	randomAlphaString = func(n int) (string, error) {
+		return "", errors.New("no entropy")
+	}
+
+	first, second := makeId(), makeId()
+	if first == "" || second == "" {
+		t.Fatalf("makeId() returned an empty ID")
+	}
+	if first == second {
+		t.Errorf("fallback IDs are not unique: %q", first)
+	}
+}
+
+func TestLoggedTiming(t *testing.T) {
+	lines := serveLogged(httptest.NewRecorder(), httptest.NewRequest("GET", "/timed", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			w.Write([]byte("ok"))
+		})
+	want := []string{
+		"2024-01-02T03:04:05.000Z [req-1] DEBUG Handling GET /timed from 192.0.2.1",
+		"2024-01-02T03:04:05.010Z [req-1] INFO Completed GET /timed from 192.0.2.1 (200, 10.00ms, 2 bytes) ttfb=5.00ms",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got lines\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// pushRecorder is an httptest.ResponseRecorder that supports server push.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (r *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	r.pushed = append(r.pushed, target)
+	return nil
+}
+
+func TestLoggingWriterKeepsPusher(t *testing.T) {
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	var isPusher bool
+	serveLogged(rec, httptest.NewRequest("GET", "/", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			var pusher http.Pusher
+			pusher, isPusher = w.(http.Pusher)
+			if isPusher {
+				pusher.Push("/style.css", nil)
+			}
+		})
+	if !isPusher {
+		t.Fatal("wrapped writer does not implement http.Pusher")
+	}
+	if len(rec.pushed) != 1 || rec.pushed[0] != "/style.css" {
+		t.Errorf("pushed %v, want [/style.css]", rec.pushed)
+	}
+}
+
+func TestLoggingWriterWithoutPusher(t *testing.T) {
+	var isPusher bool
+	serveLogged(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			_, isPusher = w.(http.Pusher)
+		})
+	if isPusher {
+		t.Error("wrapped writer implements http.Pusher although the underlying writer does not")
+	}
+}
+
+// countingWriter is a ResponseWriter that discards the body, only counting
+// it, so that huge responses can be tested without holding them in memory.
+type countingWriter struct {
+	header http.Header
+	n      int64
+}
+
+func (w *countingWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+func (w *countingWriter) WriteHeader(int) {}
+
+func TestLoggedSizeAboveMaxInt32(t *testing.T) {
+	chunk := make([]byte, 1<<20)
+	const chunks = math.MaxInt32/(1<<20) + 1
+	counter := &countingWriter{}
+	lines := serveLogged(counter, httptest.NewRequest("GET", "/big", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			for i := 0; i < chunks; i++ {
+				w.Write(chunk)
+			}
+		})
+	want := int64(chunks) << 20
+	if want <= math.MaxInt32 || counter.n != want {
+		t.Fatalf("wrote %d bytes, want %d (more than MaxInt32)", counter.n, want)
+	}
+	if end := lines[len(lines)-1]; !strings.Contains(end, fmt.Sprintf(" %d bytes)", want)) {
+		t.Errorf("end line %q does not report %d bytes", end, want)
+	}
+}
+
+func TestFlushBeforeWriteLogs200(t *testing.T) {
+	rec := httptest.NewRecorder()
+	lines := serveLogged(rec, httptest.NewRequest("GET", "/events", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			w.(http.Flusher).Flush()
+			w.Write([]byte("data: hello\n\n"))
+		})
+	if end := lines[len(lines)-1]; !strings.Contains(end, "(200, ") {
+		t.Errorf("end line %q does not log status 200", end)
+	}
+	if !rec.Flushed {
+		t.Error("flush did not reach the underlying writer")
+	}
+}
+
+func BenchmarkGetLoggerFromContext(b *testing.B) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GetLoggerFromContext(ctx)
+	}
+}
+
+func BenchmarkWrapLoggingHandler(b *testing.B) {
+	handler := WrapLoggingHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		w.Write([]byte("ok"))
+	}, WithOutput(io.Discard))
+	req := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(context.Background(), httptest.NewRecorder(), req, nil)
+	}
+}
+
+func TestControlCharactersStayOnOneLine(t *testing.T) {
+	formats := map[string][]Option{
+		"text":     nil,
+		"json":     {WithFormat(FormatJSON)},
+		"console":  {WithFormat(FormatConsole)},
+		"combined": {WithFormat(FormatCombined)},
+		"verbose":  {WithVerbose()},
+	}
+	for name, options := range formats {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			options = append([]Option{WithOutput(&out)}, options...)
+			handler := WrapLoggingHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			}, options...)
+			req := httptest.NewRequest("GET", "/a%0D%0AFAKE%20line?q=%0AFAKE", nil)
+			params := httprouter.Params{{Key: "id", Value: "1\nFAKE param"}}
+			handler(context.Background(), httptest.NewRecorder(), req, params)
+
+			for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+				if strings.HasPrefix(line, "FAKE") || strings.Contains(line, "\r") {
+					t.Errorf("control characters split the log:\n%s", out.String())
+					break
+				}
+			}
+		})
+	}
+}
+
+// writeOnly hides the io.ReaderFrom of the writer it wraps.
+type writeOnly struct {
+	http.ResponseWriter
+}
+
+func BenchmarkLoggedFileResponse(b *testing.B) {
+	const size = 8 << 20
+	path := filepath.Join(b.TempDir(), "large")
+	if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	for _, readFrom := range []bool{true, false} {
+		name := "ReadFrom"
+		if !readFrom {
+			name = "Write"
+		}
+		b.Run(name, func(b *testing.B) {
+			handler := WrapLoggingHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+				f, err := os.Open(path)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				defer f.Close()
+				if !readFrom {
+					w = writeOnly{w}
+				}
+				http.ServeContent(w, req, "large", time.Time{}, f)
+			}, WithOutput(io.Discard))
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				handler(req.Context(), w, req, nil)
+			}))
+			defer server.Close()
+
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := server.Client().Get(server.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+// hijackRecorder is an httptest.ResponseRecorder whose connection can be
+// hijacked.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	server, client := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func TestWriteAfterHijackWarns(t *testing.T) {
+	var writeErr error
+	lines := serveLogged(hijackRecorder{httptest.NewRecorder()}, httptest.NewRequest("GET", "/ws", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Fatalf("Hijack() failed: %s", err)
+			}
+			defer conn.Close()
+			_, writeErr = w.Write([]byte("too late"))
+		})
+	if !errors.Is(writeErr, http.ErrHijacked) {
+		t.Errorf("Write after Hijack returned %v, want http.ErrHijacked", writeErr)
+	}
+	found := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "[req-1] WARN ") && strings.Contains(line, "after the connection was hijacked") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no warning with the request ID in:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestResponseControllerFlushesThroughLoggingWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var flushErr error
+	serveLogged(rec, httptest.NewRequest("GET", "/events", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			flushErr = http.NewResponseController(w).Flush()
+		})
+	if flushErr != nil {
+		t.Errorf("ResponseController.Flush() = %v, want nil", flushErr)
+	}
+	if !rec.Flushed {
+		t.Error("flush did not reach the underlying writer")
+	}
+}
+
+// statusRecorder records every status written to it, including
+// informational ones.
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.statuses = append(r.statuses, status)
+	if status >= 200 {
+		r.ResponseRecorder.WriteHeader(status)
+	}
+}
+
+func TestEarlyHintsPrecedeFinalStatus(t *testing.T) {
+	rec := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	lines := serveLogged(rec, httptest.NewRequest("GET", "/", nil),
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			w.Header().Set("Link", "</style.css>; rel=preload")
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("ok"))
+		})
+	if fmt.Sprint(rec.statuses) != "[103 200]" {
+		t.Errorf("sent statuses %v, want [103 200]", rec.statuses)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "Superfluous") {
+			t.Errorf("final status logged as superfluous: %q", line)
+		}
+	}
+	if end := lines[len(lines)-1]; !strings.Contains(end, "(200, ") {
+		t.Errorf("end line %q does not log status 200", end)
+	}
+}
+
+func TestGetLoggerFromContextFallsBackToDefaultLogger(t *testing.T) {
+	var fallback, handlerOut bytes.Buffer
+	saved := defaultLogger.Load()
+	defer SetDefaultLogger(saved)
+	SetDefaultLogger(log.New(&fallback, "", 0))
+
+	WrapLoggingHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		GetLoggerFromContext(ctx).Print("inside")
+	}, WithOutput(&handlerOut), WithIDGenerator(SequentialIDGenerator()))(
+		context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+	GetLoggerFromContext(context.Background()).Print("outside")
+
+	if got := fallback.String(); got != "outside\n" {
+		t.Errorf("default logger got %q, want %q", got, "outside\n")
+	}
+	if !strings.Contains(handlerOut.String(), "[req-1] inside\n") {
+		t.Errorf("handler output %q does not contain the request's line", handlerOut.String())
+	}
+}
+
+func TestVerboseHeadersEscapedOnce(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", `C:\agent "x"`+"\x01")
+	lines := serveLogged(httptest.NewRecorder(), req,
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		}, WithVerbose())
+	want := `user_agent="C:\agent \"x\"\x01"`
+	if end := lines[len(lines)-1]; !strings.Contains(end, want) {
+		t.Errorf("end line %q does not contain %s", end, want)
+	}
+}
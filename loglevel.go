@@ -0,0 +1,58 @@
+package appkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// logLevel is the minimum level of access log lines. Its zero value is
+// LevelDebug, so everything is logged by default.
+var logLevel atomic.Int64
+
+// SetLogLevel sets the minimum level of the lines the logging middleware
+// writes. Start lines are at LevelDebug, and end lines at the level of their
+// status, so LevelInfo drops start lines and LevelWarn keeps only failed and
+// slow requests. It is safe to call while serving requests.
+func SetLogLevel(level Level) {
+	logLevel.Store(int64(level))
+}
+
+// GetLogLevel returns the level set by SetLogLevel.
+func GetLogLevel() Level {
+	return Level(logLevel.Load())
+}
+
+// LogLevelHandler reports the log level on GET, and sets it on PUT from a
+// body naming the level, e.g. "info", so it can be changed on a live server.
+// Mount it somewhere only operators can reach.
+func LogLevelHandler(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(req.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level, err := ParseLevel(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if old := GetLogLevel(); old != level {
+			GetLoggerFromContext(ctx).Printf("Log level changed from %s to %s", old, level)
+		}
+		SetLogLevel(level)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, GetLogLevel())
+}
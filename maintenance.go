@@ -0,0 +1,59 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MaintenanceOptions configures the maintenance-mode middleware.
+type MaintenanceOptions struct {
+	// AllowPaths are request paths, such as health checks, that are served
+	// normally during maintenance.
+	AllowPaths []string
+	// Body is the response body during maintenance. Defaults to the status
+	// text.
+	Body string
+	// RetryAfter, if set, is sent as the Retry-After header.
+	RetryAfter time.Duration
+}
+
+// WrapMaintenance answers every request with a 503 while enabled returns
+// true. enabled is called on each request, so maintenance can be switched on
+// and off at runtime. Switching is logged by the first request to notice it.
+func WrapMaintenance(enabled func() bool, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapMaintenanceWithOptions(enabled, handler, MaintenanceOptions{})
+}
+
+func WrapMaintenanceWithOptions(enabled func() bool, handler ContextHandlerFunc, opts MaintenanceOptions) ContextHandlerFunc {
+	if opts.Body == "" {
+		opts.Body = http.StatusText(http.StatusServiceUnavailable)
+	}
+	allowed := make(map[string]bool, len(opts.AllowPaths))
+	for _, path := range opts.AllowPaths {
+		allowed[path] = true
+	}
+	var engaged atomic.Bool
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		on := enabled()
+		if engaged.Swap(on) != on {
+			if on {
+				GetLoggerFromContext(ctx).Printf("Maintenance mode engaged")
+			} else {
+				GetLoggerFromContext(ctx).Printf("Maintenance mode disengaged")
+			}
+		}
+		if !on || allowed[req.URL.Path] {
+			handler(ctx, w, req, params)
+			return
+		}
+		if opts.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(opts.RetryAfter.Seconds())))
+		}
+		http.Error(w, opts.Body, http.StatusServiceUnavailable)
+	}
+}
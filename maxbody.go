@@ -0,0 +1,64 @@
+package appkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var contextMaxBodyBytesKey = NewContextKey[int64]("maxBodyBytes")
+
+// WithMaxBodyBytes returns a context that makes WrapMaxBodyHandler use
+// maxBytes instead of its own limit, for overriding the limit on one route.
+func WithMaxBodyBytes(ctx context.Context, maxBytes int64) context.Context {
+	return contextMaxBodyBytesKey.Set(ctx, maxBytes)
+}
+
+// WrapMaxBodyHandler limits request bodies to maxBytes, or the limit set by
+// WithMaxBodyBytes. Once a handler reads past the limit, its reads fail and,
+// unless it has already written a response, the client gets a 413.
+//
+// A handler that panics on the failed read rather than returning gets the
+// recovery middleware's 500 instead of the 413.
+func WrapMaxBodyHandler(maxBytes int64, handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if req.Body == nil {
+			handler(ctx, w, req, params)
+			return
+		}
+		limit := maxBytes
+		if override, ok := contextMaxBodyBytesKey.Get(ctx); ok {
+			limit = override
+		}
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		body := &maxBytesBody{ReadCloser: http.MaxBytesReader(loggingW, req.Body, limit)}
+		req.Body = body
+
+		handler(ctx, loggingW, req, params)
+
+		if body.exceeded {
+			GetLoggerFromContext(ctx).Printf("Request body exceeded %d bytes", limit)
+			if !loggingW.WroteHeader() {
+				http.Error(loggingW, http.StatusText(http.StatusRequestEntityTooLarge),
+					http.StatusRequestEntityTooLarge)
+			}
+		}
+	}
+}
+
+type maxBytesBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *maxBytesBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
@@ -0,0 +1,35 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// WrapMethodOverride lets POST requests, such as HTML form submissions, stand
+// in for PUT, PATCH or DELETE by naming the method in an
+// X-HTTP-Method-Override header or a _method form field. Other overrides are
+// ignored.
+//
+// Place it outside WrapLoggingHandler, e.g.
+// Chain(WrapMethodOverride, WrapLoggingHandler), so the access log shows the
+// effective method. A route has usually been chosen by the time a
+// ContextHandlerFunc runs, so for the override to affect routing it must wrap
+// a handler that dispatches itself, e.g. by calling router.ServeHTTP.
+func WrapMethodOverride(handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if req.Method == http.MethodPost {
+			method := req.Header.Get("X-HTTP-Method-Override")
+			if method == "" {
+				method = req.PostFormValue("_method")
+			}
+			switch method = strings.ToUpper(method); method {
+			case http.MethodPut, http.MethodPatch, http.MethodDelete:
+				req.Method = method
+			}
+		}
+		handler(ctx, w, req, params)
+	}
+}
@@ -0,0 +1,90 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unknownRoute labels requests whose handler was not registered with
+// ContextizeRouteHandler, so that concrete paths never become label values.
+const unknownRoute = "unknown"
+
+// otherMethod labels requests with methods outside the standard set, as
+// clients can send any method.
+const otherMethod = "OTHER"
+
+// metricsMethod returns method if it is a standard method, else otherMethod.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// MetricsOptions holds the collectors the metrics middleware updates. Create
+// it with NewMetricsOptions and register Collectors() with a registry.
+type MetricsOptions struct {
+	// Requests counts requests by method, route and status.
+	Requests *prometheus.CounterVec
+	// Latency observes request durations in seconds by method and route.
+	Latency *prometheus.HistogramVec
+}
+
+// NewMetricsOptions creates the request counter and latency histogram, with
+// names prefixed by namespace.
+func NewMetricsOptions(namespace string) MetricsOptions {
+	return MetricsOptions{
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests handled.",
+		}, []string{"method", "route", "status"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+}
+
+// Collectors returns the collectors to register.
+func (opts MetricsOptions) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{opts.Requests, opts.Latency}
+}
+
+// WrapMetricsHandler records each request in opts' collectors, labeled by
+// the route pattern from ContextizeRouteHandler. Non-standard methods are
+// labeled OTHER. Inside WrapLoggingHandler, durations are measured from the
+// request's RequestInfo.StartTime, as on the log lines.
+func WrapMetricsHandler(handler ContextHandlerFunc, opts MetricsOptions) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		start := time.Now()
+		if info, ok := RequestInfoFromContext(ctx); ok && !info.StartTime.IsZero() {
+			start = info.StartTime
+		}
+
+		handler(ctx, loggingW, req, params)
+
+		elapsed := time.Since(start)
+		route := GetRoutePatternFromContext(ctx)
+		if route == "" {
+			route = unknownRoute
+		}
+		status := loggingW.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		method := metricsMethod(req.Method)
+		opts.Requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		opts.Latency.WithLabelValues(method, route).Observe(elapsed.Seconds())
+	}
+}
@@ -0,0 +1,41 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricsUseRequestStartTime(t *testing.T) {
+	opts := NewMetricsOptions("test")
+	handler := WrapMetricsHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	}, opts)
+	ctx := contextRequestInfoKey.Set(context.Background(), &RequestInfo{StartTime: time.Now().Add(-2 * time.Second)})
+	handler(ctx, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+
+	var m dto.Metric
+	if err := opts.Latency.WithLabelValues("GET", unknownRoute).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if sum := m.GetHistogram().GetSampleSum(); sum < 2 {
+		t.Errorf("observed %.3fs, want at least the 2s since the request started", sum)
+	}
+}
+
+func TestMetricsLabelNonStandardMethodsOther(t *testing.T) {
+	opts := NewMetricsOptions("test")
+	handler := WrapMetricsHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	}, opts)
+	handler(context.Background(), httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil), nil)
+
+	if got := testutil.ToFloat64(opts.Requests.WithLabelValues(otherMethod, unknownRoute, "200")); got != 1 {
+		t.Errorf("OTHER requests = %v, want 1", got)
+	}
+}
@@ -0,0 +1,21 @@
+package appkit
+
+// Middleware wraps a ContextHandlerFunc with additional behavior.
+// WrapLoggingHandler is one.
+type Middleware func(ContextHandlerFunc) ContextHandlerFunc
+
+// Chain composes middleware left to right, so that in
+// Chain(a, b).Then(h) a runs first, then b, then h.
+func Chain(mws ...Middleware) Middleware {
+	return func(handler ContextHandlerFunc) ContextHandlerFunc {
+		for i := len(mws) - 1; i >= 0; i-- {
+			handler = mws[i](handler)
+		}
+		return handler
+	}
+}
+
+// Then applies the middleware to handler.
+func (m Middleware) Then(handler ContextHandlerFunc) ContextHandlerFunc {
+	return m(handler)
+}
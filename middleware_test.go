@@ -0,0 +1,64 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type middlewareTestKey struct{}
+
+// tagMiddleware records name on the way in and out of the handler, and
+// appends it to the context value seen by later handlers.
+func tagMiddleware(name string, calls *[]string) Middleware {
+	return func(next ContextHandlerFunc) ContextHandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			*calls = append(*calls, "before "+name)
+			seen, _ := ctx.Value(middlewareTestKey{}).(string)
+			next(context.WithValue(ctx, middlewareTestKey{}, seen+name), w, req, params)
+			*calls = append(*calls, "after "+name)
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	handler := Chain(tagMiddleware("a", &calls), tagMiddleware("b", &calls)).Then(
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			calls = append(calls, "handler")
+		})
+	handler(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+
+	want := "before a, before b, handler, after b, after a"
+	if got := strings.Join(calls, ", "); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestChainPropagatesContext(t *testing.T) {
+	var calls []string
+	var seen string
+	handler := Chain(tagMiddleware("a", &calls), tagMiddleware("b", &calls), tagMiddleware("c", &calls)).Then(
+		func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			seen, _ = ctx.Value(middlewareTestKey{}).(string)
+		})
+	handler(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+
+	if seen != "abc" {
+		t.Errorf("handler saw %q, want %q", seen, "abc")
+	}
+}
+
+func TestChainEmpty(t *testing.T) {
+	called := false
+	Chain().Then(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		called = true
+	})(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+	if !called {
+		t.Error("empty chain did not call the handler")
+	}
+}
@@ -0,0 +1,53 @@
+package appkit
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const ncsaTimestampLayout = "02/Jan/2006:15:04:05 -0700"
+
+// writeNCSALine writes a Common Log Format line, or a Combined Log Format
+// line if combined is set. timestamp is when the request was received.
+func writeNCSALine(
+	logger *log.Logger,
+	entry *logEntry,
+	timestamp time.Time,
+	status int,
+	size int64,
+	combined bool) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s - %s [%s] \"%s %s %s\" %d ",
+		ncsaField(entry.clientIP),
+		ncsaField(entry.user),
+		timestamp.Format(ncsaTimestampLayout),
+		entry.method, entry.url, entry.proto,
+		status)
+	if size > 0 {
+		fmt.Fprintf(buf, "%d", size)
+	} else {
+		buf.WriteString("-")
+	}
+	if combined {
+		fmt.Fprintf(buf, " \"%s\" \"%s\"", ncsaQuote(entry.referer), ncsaQuote(entry.userAgent))
+	}
+	logger.Print(buf.String())
+}
+
+// ncsaField returns s, or "-" if it is empty.
+func ncsaField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(s, " ", "_", -1)
+}
+
+func ncsaQuote(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(escapeControlChars(s), `"`, `\"`, -1)
+}
@@ -0,0 +1,92 @@
+package appkit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitSweepInterval is how often idle per-key limiters are discarded.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitOptions configures the rate-limiting middleware.
+type RateLimitOptions struct {
+	// Key returns the bucket a request counts against. Defaults to a single
+	// bucket shared by all requests; see RateLimitByClientIP.
+	Key func(req *http.Request) string
+}
+
+// RateLimitByClientIP keys rate limits by the client's IP address, taken the
+// same way as the logging middleware's client_ip field. If trustProxy is
+// set, trustedProxies lists the proxies in front of the server, defaulting
+// to DefaultTrustedProxies.
+func RateLimitByClientIP(trustProxy bool, trustedProxies ...string) func(req *http.Request) string {
+	trusted := trustedProxyNets(trustProxy, trustedProxies)
+	return func(req *http.Request) string {
+		return clientIP(req, trusted)
+	}
+}
+
+// WrapRateLimit allows requests at rate r with bursts of up to burst. Requests
+// over the limit get a 429 with a Retry-After header.
+func WrapRateLimit(r rate.Limit, burst int, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapRateLimitWithOptions(r, burst, handler, RateLimitOptions{})
+}
+
+func WrapRateLimitWithOptions(r rate.Limit, burst int, handler ContextHandlerFunc, opts RateLimitOptions) ContextHandlerFunc {
+	limiters := &rateLimiters{limit: r, burst: burst, byKey: make(map[string]*rate.Limiter)}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		var key string
+		if opts.Key != nil {
+			key = opts.Key(req)
+		}
+		now := time.Now()
+		res := limiters.get(key, now).ReserveN(now, 1)
+		if delay := res.DelayFrom(now); !res.OK() || delay > 0 {
+			res.CancelAt(now)
+			GetLoggerFromContext(ctx).Printf("Rate limit exceeded for %q", key)
+			if res.OK() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		handler(ctx, w, req, params)
+	}
+}
+
+// rateLimiters holds a limiter per key. Limiters whose bucket has refilled
+// are dropped periodically, since a new limiter would behave the same.
+type rateLimiters struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	byKey     map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+func (l *rateLimiters) get(key string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, lim := range l.byKey {
+			if lim.TokensAt(now) >= float64(l.burst) {
+				delete(l.byKey, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	lim, ok := l.byKey[key]
+	if !ok {
+		lim = rate.NewLimiter(l.limit, l.burst)
+		l.byKey[key] = lim
+	}
+	return lim
+}
@@ -0,0 +1,109 @@
+package appkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// PanicHandlerFunc writes the response to a request whose handler panicked
+// with recovered. GetRequestIDFromContext(ctx) gives an ID to include in it.
+type PanicHandlerFunc func(
+	ctx context.Context,
+	w http.ResponseWriter,
+	req *http.Request,
+	recovered interface{})
+
+// RecoveryOptions configures the recovery middleware.
+type RecoveryOptions struct {
+	// PanicHandler writes the response after a panic. Defaults to a plain
+	// text 500 Internal Server Error.
+	PanicHandler PanicHandlerFunc
+	// DumpAllGoroutinesOnPanic also logs the stacks of all goroutines, to
+	// help diagnose deadlocks. It is done at most once per
+	// GoroutineDumpInterval, as the dump can be large.
+	DumpAllGoroutinesOnPanic bool
+	// GoroutineDumpInterval is the minimum time between goroutine dumps.
+	// Defaults to one minute.
+	GoroutineDumpInterval time.Duration
+}
+
+const (
+	defaultGoroutineDumpInterval = time.Minute
+	maxGoroutineDumpBytes        = 64 << 20
+)
+
+// WrapRecoveryHandler recovers from panics in handler, logging the panic and
+// its stack to the context logger and responding with 500 Internal Server
+// Error if nothing has been written yet, or if what has been written can be
+// rolled back (see WrapBufferHandler). Place it inside WrapLoggingHandler,
+// e.g. Chain(WrapLoggingHandler, WrapRecoveryHandler), so that the end line
+// records the 500 and the panic, as with SetRequestError.
+func WrapRecoveryHandler(handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapRecoveryHandlerWithOptions(handler, RecoveryOptions{})
+}
+
+func WrapRecoveryHandlerWithOptions(handler ContextHandlerFunc, opts RecoveryOptions) ContextHandlerFunc {
+	if opts.PanicHandler == nil {
+		opts.PanicHandler = defaultPanicHandler
+	}
+	if opts.GoroutineDumpInterval <= 0 {
+		opts.GoroutineDumpInterval = defaultGoroutineDumpInterval
+	}
+	var lastDump atomic.Int64
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			stack := debug.Stack()
+			if p, ok := recovered.(*handlerPanic); ok {
+				// Raised again from another goroutine, e.g. by the timeout
+				// middleware; its own stack is the one that matters.
+				recovered, stack = p.value, p.stack
+			}
+			SetRequestError(ctx, fmt.Errorf("panic: %v", recovered))
+			logger := GetLoggerFromContext(ctx)
+			logger.Printf("Panic: %v\n%s", recovered, stack)
+			if opts.DumpAllGoroutinesOnPanic {
+				now := time.Now().UnixNano()
+				last := lastDump.Load()
+				if now-last >= int64(opts.GoroutineDumpInterval) && lastDump.CompareAndSwap(last, now) {
+					logger.Printf("Goroutine dump:\n%s", allGoroutineStacks())
+				}
+			}
+			if loggingW.Status() == 0 && loggingW.Size() == 0 || loggingW.rollback() {
+				opts.PanicHandler(ctx, loggingW, req, recovered)
+			}
+		}()
+		handler(ctx, loggingW, req, params)
+	}
+}
+
+func defaultPanicHandler(ctx context.Context, w http.ResponseWriter, req *http.Request, recovered interface{}) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// allGoroutineStacks returns the stacks of all goroutines, growing the
+// buffer as needed up to maxGoroutineDumpBytes.
+func allGoroutineStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxGoroutineDumpBytes {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
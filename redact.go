@@ -0,0 +1,83 @@
+package appkit
+
+import (
+	"bytes"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactHeaders are the headers redacted by the logging middleware
+// unless Options.RedactHeaders says otherwise.
+var DefaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// redactHeaderValue returns [REDACTED] in place of value if name is one of
+// the redact headers, compared case-insensitively.
+func redactHeaderValue(name string, value string, redact []string) string {
+	if value == "" {
+		return value
+	}
+	for _, r := range redact {
+		if strings.EqualFold(name, r) {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+// redactURL returns u as a string with the values of the named query
+// parameters replaced by [REDACTED]. u itself is not modified.
+func redactURL(u *url.URL, params []string) string {
+	query := redactQuery(u.RawQuery, params)
+	if query == u.RawQuery {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = query
+	return redacted.String()
+}
+
+// redactQuery returns rawQuery with the values of the named parameters
+// replaced by [REDACTED], or rawQuery itself if it has none of them.
+func redactQuery(rawQuery string, params []string) string {
+	if len(params) == 0 || rawQuery == "" {
+		return rawQuery
+	}
+	query, _ := url.ParseQuery(rawQuery)
+	redact := make(map[string]bool, len(params))
+	found := false
+	for _, p := range params {
+		redact[p] = true
+		if _, ok := query[p]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return rawQuery
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		for _, v := range query[k] {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(url.QueryEscape(k))
+			buf.WriteByte('=')
+			if redact[k] {
+				buf.WriteString(redactedValue)
+			} else {
+				buf.WriteString(url.QueryEscape(v))
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,67 @@
+package appkit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// RequestInfo bundles the request-scoped data WrapLoggingHandler stores in
+// the context.
+type RequestInfo struct {
+	// ID is the request ID, as logged and sent in the response header.
+	ID string
+	// StartTime is when the logging middleware started handling the request,
+	// for computing durations relative to the access log.
+	StartTime time.Time
+	// Logger is the request's logger, as returned by GetLoggerFromContext.
+	Logger *log.Logger
+
+	leveledLogger Logger
+	// err is shared by the copies made by withLoggers, so that an error set
+	// deep in the handler reaches the logging middleware.
+	err *requestError
+}
+
+type requestError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (r *requestError) get() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+var contextRequestInfoKey = NewContextKey[*RequestInfo]("requestInfo")
+
+// SetRequestError records err as the reason the request failed, for the
+// logging middleware to add to the end line. A later call replaces it. It
+// does nothing if ctx does not come from WrapLoggingHandler.
+func SetRequestError(ctx context.Context, err error) {
+	info, ok := contextRequestInfoKey.Get(ctx)
+	if !ok || info.err == nil {
+		return
+	}
+	info.err.mu.Lock()
+	info.err.err = err
+	info.err.mu.Unlock()
+}
+
+// RequestInfoFromContext returns the request info stored by
+// WrapLoggingHandler, and whether there was any.
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	return contextRequestInfoKey.Get(ctx)
+}
+
+// DetachContext returns a context that carries the values of ctx, such as
+// the request's logger and ID, but is never cancelled and has no deadline,
+// for work a handler starts in the background that should outlive the
+// request. Only use it deliberately: work started with it is not stopped
+// when the client goes away or the request times out, so it needs its own
+// deadline, e.g. from context.WithTimeout.
+func DetachContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
@@ -0,0 +1,112 @@
+package appkit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingWriter is an io.WriteCloser that writes to a file, moving it aside
+// once it reaches a maximum size. Backups are named path.1, path.2 and so
+// on, path.1 being the most recent. It is safe for concurrent use, so it can
+// be used directly as the logging middleware's output.
+type RotatingWriter struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingWriter opens path for appending and returns a writer that
+// rotates it before it would exceed maxBytes, keeping at most maxBackups old
+// files. maxBytes must be positive and maxBackups not negative.
+func NewRotatingWriter(path string, maxBytes int64, maxBackups int) (*RotatingWriter, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("appkit: rotating writer maxBytes must be positive, got %d", maxBytes)
+	}
+	if maxBackups < 0 {
+		return nil, fmt.Errorf("appkit: rotating writer maxBackups must not be negative, got %d", maxBackups)
+	}
+	w := &RotatingWriter{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// Write writes p to the current file, rotating first if p would take it past
+// the maximum size. A single write larger than the maximum still goes to one
+// file.
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil && w.file == nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate must be called with w.mu held.
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	var err error
+	if w.maxBackups > 0 {
+		os.Remove(w.backupName(w.maxBackups))
+		for i := w.maxBackups - 1; i >= 1; i-- {
+			os.Rename(w.backupName(i), w.backupName(i+1))
+		}
+		err = os.Rename(w.path, w.backupName(1))
+	} else {
+		err = os.Remove(w.path)
+	}
+	// Reopen even if moving the file failed, so that Write carries on in the
+	// old file rather than dropping lines.
+	if openErr := w.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+func (w *RotatingWriter) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
+
+// Close closes the current file. Writes after Close fail.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
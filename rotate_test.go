@@ -0,0 +1,48 @@
+package appkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewRotatingWriterRejectsInvalidLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	for _, tc := range []struct {
+		maxBytes   int64
+		maxBackups int
+	}{
+		{0, 1},
+		{-1, 1},
+		{1024, -1},
+	} {
+		if w, err := NewRotatingWriter(path, tc.maxBytes, tc.maxBackups); err == nil {
+			w.Close()
+			t.Errorf("NewRotatingWriter(maxBytes=%d, maxBackups=%d) succeeded, want an error", tc.maxBytes, tc.maxBackups)
+		}
+	}
+}
+
+func TestRotatingWriterRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "third\n" {
+		t.Errorf("current file = %q, want %q", b, "third\n")
+	}
+	if b, _ := os.ReadFile(path + ".1"); string(b) != "second\n" {
+		t.Errorf("backup = %q, want %q", b, "second\n")
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("found a second backup although maxBackups is 1")
+	}
+}
@@ -0,0 +1,47 @@
+package appkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const defaultServerTimingHeader = "Server-Timing"
+
+// ServerTimingOptions configures the server timing middleware.
+type ServerTimingOptions struct {
+	// Header is the response header the duration is reported in. Defaults to
+	// Server-Timing, whose value looks like "total;dur=12.30". Any other
+	// header, such as X-Response-Time, gets a value like "12.30ms".
+	Header string
+	// Disabled turns the middleware into a no-op.
+	Disabled bool
+}
+
+// WrapServerTimingHandler reports how long the handler took in a response
+// header. Since headers precede the body, the duration is measured up to the
+// point the handler starts writing its response, not to the end of it.
+func WrapServerTimingHandler(handler ContextHandlerFunc, opts ServerTimingOptions) ContextHandlerFunc {
+	if opts.Disabled {
+		return handler
+	}
+	if opts.Header == "" {
+		opts.Header = defaultServerTimingHeader
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		start := time.Now()
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		loggingW.onWriteHeader(func(status int) {
+			ms := float64(time.Since(start)) / float64(time.Millisecond)
+			if http.CanonicalHeaderKey(opts.Header) == defaultServerTimingHeader {
+				loggingW.Header().Add(opts.Header, fmt.Sprintf("total;dur=%.2f", ms))
+			} else {
+				loggingW.Header().Set(opts.Header, fmt.Sprintf("%.2fms", ms))
+			}
+		})
+		handler(ctx, loggingW, req, params)
+	}
+}
@@ -0,0 +1,238 @@
+package appkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultSessionCookieName = "session"
+	defaultSessionMaxAge     = 24 * time.Hour
+	sessionIDBytes           = 32
+)
+
+// SessionStore keeps session values by session ID. MemorySessionStore
+// implements it.
+type SessionStore interface {
+	// Load returns the values of session id, and whether it exists.
+	Load(id string) (map[string]interface{}, bool)
+	// Save replaces the values of session id, keeping them for ttl.
+	Save(id string, values map[string]interface{}, ttl time.Duration) error
+}
+
+// SessionOptions configures the session middleware.
+type SessionOptions struct {
+	// Key signs the session cookie. Defaults to a random key, so sessions do
+	// not survive a restart or span instances.
+	Key []byte
+	// CookieName defaults to session.
+	CookieName string
+	// Path of the cookie. Defaults to "/".
+	Path string
+	// Secure limits the cookie to HTTPS.
+	Secure bool
+	// SameSite of the cookie. Defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+	// MaxAge is how long sessions last after their last change. Defaults to
+	// 24 hours.
+	MaxAge time.Duration
+}
+
+// Session holds the values of one client's session. It is safe for
+// concurrent use.
+type Session struct {
+	// ID identifies the session in the store.
+	ID string
+
+	mu       sync.Mutex
+	values   map[string]interface{}
+	modified bool
+	saved    bool
+}
+
+// Get returns the value stored under key, or nil.
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// Set stores value under key.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.modified = true
+}
+
+// Delete removes key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.modified = true
+}
+
+var contextSessionKey = NewContextKey[*Session]("session")
+
+// SessionFromContext returns the session loaded by WrapSession, or nil if
+// there is none.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := contextSessionKey.Get(ctx)
+	return session
+}
+
+// WrapSession loads the session named by the request's cookie, or starts a
+// new one if the cookie is missing, invalid or names an unknown session, and
+// makes it available from SessionFromContext. If the handler changes the
+// session, it is saved, and the cookie set, just before the response headers
+// are sent.
+func WrapSession(store SessionStore, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapSessionWithOptions(store, handler, SessionOptions{})
+}
+
+func WrapSessionWithOptions(store SessionStore, handler ContextHandlerFunc, opts SessionOptions) ContextHandlerFunc {
+	if len(opts.Key) == 0 {
+		opts.Key = make([]byte, 32)
+		if _, err := rand.Read(opts.Key); err != nil {
+			panic("appkit: cannot generate session key: " + err.Error())
+		}
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultSessionCookieName
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultSessionMaxAge
+	}
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		logger := GetLoggerFromContext(ctx)
+		session, err := opts.load(store, req)
+		if err != nil {
+			logger.Printf("Failed to create session: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		save := func() {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			if !session.modified || session.saved {
+				return
+			}
+			session.saved = true
+			if err := store.Save(session.ID, session.values, opts.MaxAge); err != nil {
+				logger.Printf("Failed to save session: %s", err)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     opts.CookieName,
+				Value:    session.ID + "." + signSessionID(opts.Key, session.ID),
+				Path:     opts.Path,
+				MaxAge:   int(opts.MaxAge / time.Second),
+				Secure:   opts.Secure,
+				HttpOnly: true,
+				SameSite: opts.SameSite,
+			})
+		}
+
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		loggingW.onWriteHeader(func(int) { save() })
+		handler(contextSessionKey.Set(ctx, session), loggingW, req, params)
+		if !loggingW.WroteHeader() {
+			// Nothing was written, so net/http will send the headers after
+			// we return.
+			save()
+		}
+	}
+}
+
+// load returns the session named by req's cookie, or a new one.
+func (opts *SessionOptions) load(store SessionStore, req *http.Request) (*Session, error) {
+	if cookie, err := req.Cookie(opts.CookieName); err == nil {
+		id, sig, found := strings.Cut(cookie.Value, ".")
+		if found && hmac.Equal([]byte(sig), []byte(signSessionID(opts.Key, id))) {
+			if values, ok := store.Load(id); ok {
+				return &Session{ID: id, values: values}, nil
+			}
+		}
+	}
+	b := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Session{ID: base64.RawURLEncoding.EncodeToString(b), values: make(map[string]interface{})}, nil
+}
+
+func signSessionID(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// MemorySessionStore keeps sessions in memory, for a single instance or
+// tests. It is safe for concurrent use.
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+// Load returns a copy of the values of session id, if it has not expired.
+func (s *MemorySessionStore) Load(id string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.expires) {
+		return nil, false
+	}
+	return copySessionValues(session.values), true
+}
+
+// Save stores a copy of values as session id for ttl.
+func (s *MemorySessionStore) Save(id string, values map[string]interface{}, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= memoryStoreSweepInterval {
+		for k, session := range s.sessions {
+			if now.After(session.expires) {
+				delete(s.sessions, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.sessions[id] = memorySession{values: copySessionValues(values), expires: now.Add(ttl)}
+	return nil
+}
+
+func copySessionValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,67 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWrapSession(t *testing.T) {
+	key := []byte("test key")
+	store := NewMemorySessionStore()
+	var seen *Session
+	handler := WrapSessionWithOptions(store, func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		seen = SessionFromContext(ctx)
+		if req.URL.Path == "/visit" {
+			count, _ := seen.Get("count").(int)
+			seen.Set("count", count+1)
+			w.Write([]byte("counted"))
+		}
+	}, SessionOptions{Key: key})
+	serve := func(path, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		handler(context.Background(), rec, req, nil)
+		return rec
+	}
+
+	rec := serve("/visit", "")
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("first visit set cookies %v, want one HttpOnly session cookie", cookies)
+	}
+	valid, id := cookies[0].Value, seen.ID
+
+	serve("/visit", valid)
+	if seen.ID != id || seen.Get("count") != 2 {
+		t.Fatalf("second visit got session %q with count %v, want %q with 2", seen.ID, seen.Get("count"), id)
+	}
+
+	if rec := serve("/read", valid); len(rec.Result().Cookies()) != 0 {
+		t.Errorf("unmodified session set cookies %v", rec.Result().Cookies())
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"forged signature", id + ".forged"},
+		{"signed with another key", id + "." + signSessionID([]byte("other key"), id)},
+		{"unknown session", "unknown." + signSessionID(key, "unknown")},
+		{"no signature", id},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			serve("/read", tc.cookie)
+			if seen.ID == id || seen.Get("count") != nil {
+				t.Errorf("got session %q with count %v, want a fresh session", seen.ID, seen.Get("count"))
+			}
+		})
+	}
+}
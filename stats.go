@@ -0,0 +1,143 @@
+package appkit
+
+import (
+	"context"
+	"math/bits"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Latencies are counted in a log-linear histogram of microseconds: each
+// power of two is split into statsSubBuckets equal buckets, with exact
+// buckets below statsSubBuckets µs. That bounds memory at statsBuckets
+// counters whatever the traffic, while keeping every bucket's width within
+// 1/statsSubBuckets of its lower bound. Latencies past the last bucket, about
+// 35 minutes, are counted in it.
+const (
+	statsSubBucketBits = 3
+	statsSubBuckets    = 1 << statsSubBucketBits
+	statsOctaves       = 28
+	statsBuckets       = statsSubBuckets + statsOctaves*statsSubBuckets
+)
+
+// Stats keeps aggregate request statistics in memory, for a debug or
+// health endpoint when a metrics system is overkill. The zero value is ready
+// to use. It is safe for concurrent use and takes no locks.
+type Stats struct {
+	requests atomic.Uint64
+	classes  [6]atomic.Uint64
+	totalNs  atomic.Uint64
+	buckets  [statsBuckets]atomic.Uint64
+}
+
+// StatsSnapshot holds the values of a Stats at one point in time.
+type StatsSnapshot struct {
+	Requests uint64
+	// ByStatusClass counts responses by class, e.g. "2xx".
+	ByStatusClass map[string]uint64
+	// AverageLatency is the mean time spent in the handler.
+	AverageLatency time.Duration
+	// P50, P90 and P99 are latency percentiles. They are estimated from a
+	// histogram as the midpoint of the bucket the percentile falls in, so
+	// are within 1/16 (6.25%) of the true value, or 0.5µs for requests
+	// faster than 8µs.
+	P50, P90, P99 time.Duration
+}
+
+// Wrap records statistics for requests to handler.
+func (s *Stats) Wrap(handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		loggingW := ensureLoggingResponseWriter(w, getLeveledLoggerFromContext(ctx))
+		start := time.Now()
+		handler(ctx, loggingW, req, params)
+		s.record(loggingW.Status(), time.Since(start))
+	}
+}
+
+func (s *Stats) record(status int, elapsed time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	class := status / 100
+	if class < 1 || class > 5 {
+		class = 0
+	}
+	s.requests.Add(1)
+	s.classes[class].Add(1)
+	s.totalNs.Add(uint64(elapsed))
+	s.buckets[statsBucket(elapsed)].Add(1)
+}
+
+// statsBucket returns the index of the histogram bucket counting elapsed.
+func statsBucket(elapsed time.Duration) int {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	us := uint64(elapsed / time.Microsecond)
+	if us < statsSubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - 1 - statsSubBucketBits
+	if shift >= statsOctaves {
+		return statsBuckets - 1
+	}
+	sub := int(us>>shift) - statsSubBuckets
+	return statsSubBuckets + shift*statsSubBuckets + sub
+}
+
+// statsBucketMidpoint returns the latency in the middle of bucket i.
+func statsBucketMidpoint(i int) time.Duration {
+	if i < statsSubBuckets {
+		return time.Duration(i)*time.Microsecond + time.Microsecond/2
+	}
+	shift := (i - statsSubBuckets) / statsSubBuckets
+	sub := (i - statsSubBuckets) % statsSubBuckets
+	lower := uint64(statsSubBuckets+sub) << shift
+	width := uint64(1) << shift
+	return time.Duration(lower)*time.Microsecond + time.Duration(width)*time.Microsecond/2
+}
+
+// Snapshot returns the current statistics. Counters are read one at a time,
+// so a snapshot taken under load may be slightly inconsistent.
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		Requests:      s.requests.Load(),
+		ByStatusClass: make(map[string]uint64),
+	}
+	for class := range s.classes {
+		if n := s.classes[class].Load(); n > 0 {
+			name := "other"
+			if class > 0 {
+				name = string(rune('0'+class)) + "xx"
+			}
+			snap.ByStatusClass[name] = n
+		}
+	}
+	if snap.Requests == 0 {
+		return snap
+	}
+	snap.AverageLatency = time.Duration(s.totalNs.Load() / snap.Requests)
+
+	var counts [statsBuckets]uint64
+	var total uint64
+	for i := range s.buckets {
+		counts[i] = s.buckets[i].Load()
+		total += counts[i]
+	}
+	percentile := func(q float64) time.Duration {
+		target := uint64(q * float64(total))
+		var seen uint64
+		for i, n := range counts {
+			seen += n
+			if seen > target || i == statsBuckets-1 {
+				return statsBucketMidpoint(i)
+			}
+		}
+		return 0
+	}
+	snap.P50, snap.P90, snap.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	return snap
+}
@@ -0,0 +1,85 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestStatsCountsStatusClasses(t *testing.T) {
+	var stats Stats
+	for _, status := range []int{0, 200, 201, 301, 404, 404, 500} {
+		handler := stats.Wrap(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			if status != 0 {
+				w.WriteHeader(status)
+			}
+		})
+		handler(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+	}
+	stats.record(99, time.Millisecond)
+
+	snap := stats.Snapshot()
+	want := map[string]uint64{"2xx": 3, "3xx": 1, "4xx": 2, "5xx": 1, "other": 1}
+	if snap.Requests != 8 {
+		t.Errorf("Requests = %d, want 8", snap.Requests)
+	}
+	for class, n := range want {
+		if snap.ByStatusClass[class] != n {
+			t.Errorf("ByStatusClass[%q] = %d, want %d", class, snap.ByStatusClass[class], n)
+		}
+	}
+	if len(snap.ByStatusClass) != len(want) {
+		t.Errorf("ByStatusClass = %v, want %v", snap.ByStatusClass, want)
+	}
+}
+
+func TestStatsPercentiles(t *testing.T) {
+	var stats Stats
+	for i := 1; i <= 1000; i++ {
+		stats.record(http.StatusOK, time.Duration(i)*time.Millisecond)
+	}
+	snap := stats.Snapshot()
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"P50", snap.P50, 500 * time.Millisecond},
+		{"P90", snap.P90, 900 * time.Millisecond},
+		{"P99", snap.P99, 990 * time.Millisecond},
+		{"AverageLatency", snap.AverageLatency, 500500 * time.Microsecond},
+	}
+	for _, tc := range tests {
+		if diff := tc.got - tc.want; diff < -tc.want/16 || diff > tc.want/16 {
+			t.Errorf("%s = %s, want within 1/16 of %s", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestStatsBucketMidpointError(t *testing.T) {
+	for us := time.Duration(0); us < 100000; us += 7 {
+		elapsed := us * time.Microsecond
+		mid := statsBucketMidpoint(statsBucket(elapsed))
+		diff := mid - elapsed
+		if diff < 0 {
+			diff = -diff
+		}
+		if elapsed < statsSubBuckets*time.Microsecond {
+			if diff > time.Microsecond/2 {
+				t.Fatalf("%s is estimated as %s", elapsed, mid)
+			}
+		} else if diff > elapsed/16 {
+			t.Fatalf("%s is estimated as %s, more than 1/16 off", elapsed, mid)
+		}
+	}
+	if got := statsBucket(24 * time.Hour); got != statsBuckets-1 {
+		t.Errorf("statsBucket(24h) = %d, want the last bucket %d", got, statsBuckets-1)
+	}
+	if got := statsBucket(-time.Second); got != 0 {
+		t.Errorf("statsBucket(-1s) = %d, want 0", got)
+	}
+}
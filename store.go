@@ -0,0 +1,69 @@
+package appkit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// memoryStoreSweepInterval is how often expired entries are removed.
+const memoryStoreSweepInterval = time.Minute
+
+// StoredResponse is a response saved for replaying later.
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ResponseStore saves responses for WrapCache and WrapIdempotency.
+// MemoryStore implements it.
+type ResponseStore interface {
+	Get(key string) (*StoredResponse, bool)
+	Set(key string, resp *StoredResponse, ttl time.Duration)
+}
+
+// MemoryStore keeps responses in memory, for a single instance or tests. It
+// is safe for concurrent use.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryStoreEntry
+	lastSweep time.Time
+}
+
+type memoryStoreEntry struct {
+	resp    *StoredResponse
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryStoreEntry)}
+}
+
+// Get returns the response stored under key, if it has not expired.
+func (s *MemoryStore) Get(key string) (*StoredResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.resp, true
+}
+
+// Set stores resp under key for ttl.
+func (s *MemoryStore) Set(key string, resp *StoredResponse, ttl time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= memoryStoreSweepInterval {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.entries[key] = memoryStoreEntry{resp: resp, expires: now.Add(ttl)}
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+
+package appkit
+
+import (
+	"bytes"
+	"log/syslog"
+)
+
+// NewSyslogLogger returns a Logger that sends lines to the local syslog
+// daemon, for use with WithLogger. The facility is taken from priority, and
+// each line's severity from its level, so access log end lines are errors
+// for 5xx responses and warnings for 4xx ones.
+//
+// log/syslog is not available on Windows or Plan 9, so neither is this.
+func NewSyslogLogger(priority syslog.Priority, tag string) (Logger, error) {
+	w, err := syslog.New(priority, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogLogger{w}, nil
+}
+
+type syslogLogger struct {
+	w *syslog.Writer
+}
+
+func (s *syslogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.w.Debug(formatSyslogLine(msg, keyvals))
+}
+
+func (s *syslogLogger) Info(msg string, keyvals ...interface{}) {
+	s.w.Info(formatSyslogLine(msg, keyvals))
+}
+
+func (s *syslogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.w.Warning(formatSyslogLine(msg, keyvals))
+}
+
+func (s *syslogLogger) Error(msg string, keyvals ...interface{}) {
+	s.w.Err(formatSyslogLine(msg, keyvals))
+}
+
+func formatSyslogLine(msg string, keyvals []interface{}) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString(msg)
+	writeKeyvals(buf, keyvals)
+	return buf.String()
+}
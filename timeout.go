@@ -0,0 +1,197 @@
+package appkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TimeoutOptions configures the timeout middleware.
+type TimeoutOptions struct {
+	// Status is the response status when the handler times out before
+	// writing anything. Defaults to 503 Service Unavailable.
+	Status int
+}
+
+// WrapTimeoutHandler runs handler with a context that expires after d. If
+// the handler has not written anything when the deadline passes, the client
+// gets a 503 and the timeout is logged; if it has, it is left to finish.
+//
+// The deadline only interrupts work that watches ctx.Done(). A handler that
+// ignores its context keeps running after the 503 has been sent, although
+// anything it writes from then on is discarded.
+func WrapTimeoutHandler(d time.Duration, handler ContextHandlerFunc) ContextHandlerFunc {
+	return WrapTimeoutHandlerWithOptions(d, handler, TimeoutOptions{})
+}
+
+func WrapTimeoutHandlerWithOptions(d time.Duration, handler ContextHandlerFunc, opts TimeoutOptions) ContextHandlerFunc {
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+	return wrapTimeout(func(*http.Request) time.Duration { return d }, handler, opts.Status)
+}
+
+// wrapTimeout is WrapTimeoutHandler with the timeout chosen per request by
+// timeoutFor. A timeout of zero or less means no timeout.
+func wrapTimeout(timeoutFor func(req *http.Request) time.Duration, handler ContextHandlerFunc, status int) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		d := timeoutFor(req)
+		if d <= 0 {
+			handler(ctx, w, req, params)
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		tw := &timeoutWriter{w: w, header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan *handlerPanic, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- &handlerPanic{p, debug.Stack()}
+					return
+				}
+				close(done)
+			}()
+			handler(ctx, tw, req, params)
+		}()
+
+		// wait lets the handler finish, as it may still write to w.
+		wait := func() {
+			select {
+			case p := <-panicked:
+				p.repanic()
+			case <-done:
+			}
+		}
+
+		select {
+		case p := <-panicked:
+			p.repanic()
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// The request itself was cancelled, e.g. by the client going
+			// away, which is not a timeout.
+			wait()
+			return
+		}
+
+		tw.mu.Lock()
+		if tw.wroteHeader {
+			tw.mu.Unlock()
+			wait()
+			return
+		}
+		tw.timedOut = true
+		tw.mu.Unlock()
+
+		logger := GetLoggerFromContext(ctx)
+		logger.Printf("Timed out after %s", d)
+		http.Error(w, http.StatusText(status), status)
+
+		// Nothing is left to recover a later panic, so at least log it.
+		go func() {
+			select {
+			case p := <-panicked:
+				logger.Printf("Panic after timeout: %v\n%s", p.value, p.stack)
+			case <-done:
+			}
+		}()
+	}
+}
+
+// handlerPanic is a panic in a handler running in its own goroutine, raised
+// again in the goroutine serving the request. It keeps the stack of the
+// handler's goroutine, which WrapRecoveryHandler logs instead of its own.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *handlerPanic) Error() string {
+	return fmt.Sprint(p.value)
+}
+
+// repanic raises p in the calling goroutine. http.ErrAbortHandler is raised
+// as is, since net/http treats it specially.
+func (p *handlerPanic) repanic() {
+	if p.value == http.ErrAbortHandler {
+		panic(p.value)
+	}
+	panic(p)
+}
+
+// timeoutWriter buffers headers until the handler writes, and discards
+// writes once the timeout response has been sent.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.wroteHeader = true
+	tw.w.WriteHeader(status)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController. Writes
+// made through it bypass the timeout.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,54 @@
+package appkit
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func waitForDone(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	<-ctx.Done()
+}
+
+func TestWrapTimeoutHandlerDeadline(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WrapTimeoutHandler(10*time.Millisecond, waitForDone)(context.Background(), rec, httptest.NewRequest("GET", "/", nil), nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWrapTimeoutHandlerParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	WrapTimeoutHandler(time.Hour, waitForDone)(ctx, rec, httptest.NewRequest("GET", "/", nil), nil)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("cancelled request got status %d with body %q, want no timeout response", rec.Code, rec.Body.String())
+	}
+}
+
+func panicInTimedHandler(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	panic("boom")
+}
+
+func TestTimeoutPanicKeepsHandlerStack(t *testing.T) {
+	var out bytes.Buffer
+	ctx := ContextWithLogger(context.Background(), log.New(&out, "", 0))
+	rec := httptest.NewRecorder()
+	WrapRecoveryHandler(WrapTimeoutHandler(time.Hour, panicInTimedHandler))(ctx, rec, httptest.NewRequest("GET", "/", nil), nil)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.HasPrefix(out.String(), "Panic: boom\n") || !strings.Contains(out.String(), "panicInTimedHandler") {
+		t.Errorf("logged panic lacks the handler's stack:\n%s", out.String())
+	}
+}
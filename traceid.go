@@ -0,0 +1,54 @@
+package appkit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequestIDExtractor derives a request ID from an incoming request, returning
+// an empty string if the request does not carry one.
+type RequestIDExtractor func(req *http.Request) string
+
+// CloudTraceID extracts the trace ID from Google Cloud's
+// X-Cloud-Trace-Context header ("TRACE_ID/SPAN_ID;o=1"), so that log lines
+// link to Cloud Trace.
+func CloudTraceID(req *http.Request) string {
+	header := req.Header.Get("X-Cloud-Trace-Context")
+	traceID := header
+	if i := strings.IndexAny(header, "/;"); i >= 0 {
+		traceID = header[:i]
+	}
+	if len(traceID) != 32 || !isHex(traceID) {
+		return ""
+	}
+	return traceID
+}
+
+// XRayTraceID extracts the root trace ID from AWS X-Ray's X-Amzn-Trace-Id
+// header ("Root=1-5759e988-bd862e3fe1be46a994272793;Parent=...").
+func XRayTraceID(req *http.Request) string {
+	for _, field := range strings.Split(req.Header.Get("X-Amzn-Trace-Id"), ";") {
+		field = strings.TrimSpace(field)
+		if !strings.HasPrefix(field, "Root=") {
+			continue
+		}
+		root := field[len("Root="):]
+		parts := strings.Split(root, "-")
+		if len(parts) != 3 || parts[0] != "1" ||
+			len(parts[1]) != 8 || !isHex(parts[1]) ||
+			len(parts[2]) != 24 || !isHex(parts[2]) {
+			return ""
+		}
+		return root
+	}
+	return ""
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
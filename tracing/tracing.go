@@ -0,0 +1,200 @@
+// Package tracing provides OpenTelemetry tracing middleware for appkit
+// handlers. It lives in its own package so that appkit itself does not
+// depend on OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/t11e/go-appkit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/t11e/go-appkit/tracing"
+
+// Options configures the tracing middleware.
+type Options struct {
+	// TracerProvider creates the tracer. Defaults to otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+	// Propagator extracts the incoming trace context. Defaults to
+	// otel.GetTextMapPropagator(), or W3C Trace Context if that is a no-op.
+	Propagator propagation.TextMapPropagator
+}
+
+// WrapTracingHandler starts a span around each request, continuing any trace
+// from the incoming traceparent header, and passes the span to handler in the
+// context. Place it inside appkit.WrapLoggingHandler for the span to carry the
+// request ID.
+func WrapTracingHandler(handler appkit.ContextHandlerFunc, opts Options) appkit.ContextHandlerFunc {
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+	if opts.Propagator == nil {
+		opts.Propagator = otel.GetTextMapPropagator()
+		if len(opts.Propagator.Fields()) == 0 {
+			opts.Propagator = propagation.TraceContext{}
+		}
+	}
+	tracer := opts.TracerProvider.Tracer(instrumentationName)
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx = opts.Propagator.Extract(ctx, propagation.HeaderCarrier(req.Header))
+
+		route := appkit.GetRoutePatternFromContext(ctx)
+		name := req.Method
+		if route != "" {
+			name = req.Method + " " + route
+		}
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+		}
+		if route != "" {
+			attrs = append(attrs, attribute.String("http.route", route))
+		}
+		if id := appkit.GetRequestIDFromContext(ctx); id != "" {
+			attrs = append(attrs, attribute.String("request.id", id))
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...))
+		defer span.End()
+
+		// Inside WrapLoggingHandler the writer already tracks the status, so
+		// it is passed on as is rather than hiding it behind another wrapper.
+		var statusW *statusWriter
+		if _, ok := appkit.ResponseStatus(w); !ok {
+			statusW = &statusWriter{ResponseWriter: w}
+			w = wrapStatusWriter(statusW)
+		}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				span.AddEvent("panic", trace.WithAttributes(
+					attribute.String("panic.value", fmt.Sprint(recovered))))
+				span.SetStatus(codes.Error, "panic")
+				panic(recovered)
+			}
+		}()
+
+		handler(ctx, w, req, params)
+
+		var status int
+		if statusW != nil {
+			status = statusW.status
+		} else {
+			status, _ = appkit.ResponseStatus(w)
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		span.AddEvent("response", trace.WithAttributes(attribute.Int("http.response.status_code", status)))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// statusWriter records the status of a response to a writer that does not
+// track it itself.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// wrapStatusWriter returns w with the optional interfaces of the writer it
+// wraps, as appkit's own wrappers do.
+func wrapStatusWriter(w *statusWriter) http.ResponseWriter {
+	h, ok1 := w.ResponseWriter.(http.Hijacker)
+	c, ok2 := w.ResponseWriter.(http.CloseNotifier)
+	p, ok3 := w.ResponseWriter.(http.Pusher)
+	switch {
+	case ok1 && ok2 && ok3:
+		return struct {
+			*statusWriter
+			http.Hijacker
+			http.CloseNotifier
+			http.Pusher
+		}{w, h, c, p}
+	case ok1 && ok2:
+		return struct {
+			*statusWriter
+			http.Hijacker
+			http.CloseNotifier
+		}{w, h, c}
+	case ok1 && ok3:
+		return struct {
+			*statusWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case ok2 && ok3:
+		return struct {
+			*statusWriter
+			http.CloseNotifier
+			http.Pusher
+		}{w, c, p}
+	case ok1:
+		return struct {
+			*statusWriter
+			http.Hijacker
+		}{w, h}
+	case ok2:
+		return struct {
+			*statusWriter
+			http.CloseNotifier
+		}{w, c}
+	case ok3:
+		return struct {
+			*statusWriter
+			http.Pusher
+		}{w, p}
+	}
+	return w
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom keeps sendfile working when the underlying writer supports it.
+func (w *statusWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/t11e/go-appkit"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestWrapTracingHandlerKeepsHijacker(t *testing.T) {
+	var isHijacker, canUnwrap bool
+	handler := WrapTracingHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		_, isHijacker = w.(http.Hijacker)
+		_, canUnwrap = w.(interface{ Unwrap() http.ResponseWriter })
+	}, Options{TracerProvider: noop.NewTracerProvider()})
+	handler(context.Background(), hijackRecorder{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil), nil)
+	if !isHijacker {
+		t.Error("wrapped writer does not implement http.Hijacker")
+	}
+	if !canUnwrap {
+		t.Error("wrapped writer does not implement Unwrap")
+	}
+}
+
+func TestWrapTracingHandlerReusesLoggingWriter(t *testing.T) {
+	var outer, inner http.ResponseWriter
+	handler := appkit.WrapLoggingHandlerWithOptions(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		outer = w
+		WrapTracingHandler(func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			inner = w
+		}, Options{TracerProvider: noop.NewTracerProvider()})(ctx, w, req, params)
+	}, appkit.WithOutput(io.Discard))
+	handler(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+	if inner != outer {
+		t.Error("tracing wrapped the logging middleware's writer again")
+	}
+}
@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/t11e/go-appkit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// NewPropagatingTransport returns an http.RoundTripper that adds the trace
+// context (traceparent) and the appkit request ID (X-Request-ID) carried by
+// each outbound request's context to its headers before passing it to base,
+// or http.DefaultTransport if base is nil.
+//
+// For the IDs to flow, outbound requests must be made with the context the
+// handler received:
+//
+//	client := &http.Client{Transport: tracing.NewPropagatingTransport(nil)}
+//	outReq, err := http.NewRequest("GET", url, nil)
+//	...
+//	resp, err := client.Do(outReq.WithContext(ctx))
+func NewPropagatingTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &propagatingTransport{base: base}
+}
+
+type propagatingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	propagator := otel.GetTextMapPropagator()
+	if len(propagator.Fields()) == 0 {
+		propagator = propagation.TraceContext{}
+	}
+
+	// RoundTrippers must not modify the request they are given.
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if id := appkit.GetRequestIDFromContext(ctx); id != "" && req.Header.Get(requestIDHeader) == "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,60 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Tracker tracks in-flight requests so that shutdown can wait for them,
+// including hijacked and streaming ones that http.Server.Shutdown does not
+// wait for. The zero value is ready to use.
+type Tracker struct {
+	mu           sync.Mutex
+	wg           sync.WaitGroup
+	shuttingDown bool
+}
+
+// Wrap counts requests to handler as in flight until it returns. Once
+// Shutdown has been called, new requests get a 503.
+func (t *Tracker) Wrap(handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		t.mu.Lock()
+		if t.shuttingDown {
+			t.mu.Unlock()
+			w.Header().Set("Connection", "close")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		t.wg.Add(1)
+		t.mu.Unlock()
+		defer t.wg.Done()
+		handler(ctx, w, req, params)
+	}
+}
+
+// Shutdown makes Wrap reject new requests.
+func (t *Tracker) Shutdown() {
+	t.mu.Lock()
+	t.shuttingDown = true
+	t.mu.Unlock()
+}
+
+// Wait blocks until there are no requests in flight, or until ctx is done,
+// in which case it returns ctx.Err(). Call Shutdown first, otherwise new
+// requests may keep Wait from returning.
+func (t *Tracker) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
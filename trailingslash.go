@@ -0,0 +1,59 @@
+package appkit
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SlashStyle is the trailing-slash convention WrapTrailingSlash enforces.
+type SlashStyle int
+
+const (
+	// StripTrailingSlash redirects /foo/ to /foo.
+	StripTrailingSlash SlashStyle = iota
+	// AddTrailingSlash redirects /foo to /foo/.
+	AddTrailingSlash
+)
+
+// WrapTrailingSlash redirects requests whose path does not follow style,
+// keeping the query string. GET and HEAD requests get a 301; others get a
+// 308 so that clients repeat the method and body. The root path is never
+// redirected.
+//
+// httprouter only runs a route's handler for paths that already match it, so
+// wrap a handler that covers the alternative form too, such as the router's
+// NotFound handler.
+func WrapTrailingSlash(style SlashStyle, handler ContextHandlerFunc) ContextHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		path := req.URL.Path
+		normalized := path
+		if path != "/" {
+			switch style {
+			case StripTrailingSlash:
+				normalized = strings.TrimRight(path, "/")
+			case AddTrailingSlash:
+				if !strings.HasSuffix(path, "/") {
+					normalized = path + "/"
+				}
+			}
+		}
+		if normalized == path || normalized == "" {
+			handler(ctx, w, req, params)
+			return
+		}
+
+		// Collapse leading slashes so the target cannot be read as a
+		// protocol-relative URL pointing at another host.
+		normalized = "/" + strings.TrimLeft(normalized, "/")
+		target := (&url.URL{Path: normalized, RawQuery: req.URL.RawQuery}).RequestURI()
+		status := http.StatusPermanentRedirect
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, req, target, status)
+	}
+}